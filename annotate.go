@@ -0,0 +1,124 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+)
+
+// annotateColumns are the columns added to every row of an annotate file
+var annotateColumns = []string{"xrun_status", "xrun_exit_code", "xrun_duration_ms", "xrun_stdout", "xrun_error"}
+
+// annotateWriter writes every input row back out in the data file's format,
+// with annotateColumns describing how the row's command ran. Rows are written
+// in input order, however the commands finished. It is safe for concurrent
+// use.
+type annotateWriter struct {
+	mu      sync.Mutex
+	rows    rowFileWriter
+	next    int
+	pending map[int]Row
+}
+
+func newAnnotateWriter(path string, format *Format) *annotateWriter {
+	return &annotateWriter{
+		rows:    rowFileWriter{path: path, format: format},
+		next:    1,
+		pending: make(map[int]Row),
+	}
+}
+
+// write records the annotated row for report, writing it together with any
+// rows it was holding back once all rows before it are done
+func (w *annotateWriter) write(report rowReport) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending[report.job.progress.Current] = annotatedRow(report)
+	for {
+		row, ok := w.pending[w.next]
+		if !ok {
+			return nil
+		}
+		delete(w.pending, w.next)
+		w.next++
+		if err := w.writeRow(row); err != nil {
+			return err
+		}
+	}
+}
+
+// writeRow writes row unless it could not be read from the data file
+func (w *annotateWriter) writeRow(row Row) error {
+	if row.Values == nil {
+		return nil
+	}
+	return w.rows.write(row)
+}
+
+// Close writes the rows still held back, which only happens when rows
+// before them never finished, and finishes the file
+func (w *annotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	remaining := make([]int, 0, len(w.pending))
+	for n := range w.pending {
+		remaining = append(remaining, n)
+	}
+	sort.Ints(remaining)
+	for _, n := range remaining {
+		if err := w.writeRow(w.pending[n]); err != nil {
+			return err
+		}
+	}
+	w.pending = nil
+
+	_, err := w.rows.close()
+	return err
+}
+
+// annotatedRow returns the input row of report with annotateColumns added
+func annotatedRow(report rowReport) Row {
+	source := report.job.row
+	if source.Values == nil {
+		return source
+	}
+
+	values := make(map[string]any, len(source.Values)+len(annotateColumns))
+	for key, value := range source.Values {
+		values[key] = value
+	}
+	values["xrun_status"] = report.status.String()
+	values["xrun_exit_code"] = nil
+	values["xrun_duration_ms"] = nil
+	values["xrun_stdout"] = ""
+	values["xrun_error"] = ""
+	if result := report.result; result != nil {
+		if code, _ := exitStatus(result.err); code != nil {
+			values["xrun_exit_code"] = *code
+		}
+		values["xrun_duration_ms"] = result.duration().Milliseconds()
+		if result.err != nil {
+			values["xrun_error"] = result.err.Error()
+		}
+	} else if report.status != RowSucceeded {
+		values["xrun_error"] = report.status.String()
+	}
+	if report.output != nil {
+		values["xrun_stdout"], _ = report.output.stdout.contents()
+	}
+
+	// Keep the original column order, annotating a file twice replaces the
+	// columns instead of repeating them
+	var fields []string
+	if source.Fields != nil {
+		fields = append(fields, source.Fields...)
+		for _, column := range annotateColumns {
+			if !slices.Contains(source.Fields, column) {
+				fields = append(fields, column)
+			}
+		}
+	}
+	return Row{Index: source.Index, Fields: fields, Values: values}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessDataFileAnnotateCSV(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.csv")
+	csvContent := `zone,script,id
+b,sleep 0.3; echo first,1
+a,echo second; exit 4,2
+c,{{.missing}},3
+`
+	if err := os.WriteFile(dataFile, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	annotateFile := filepath.Join(dir, "out.csv")
+	config := Config{
+		DataFile:           dataFile,
+		Template:           `{{if eq .id "3"}}{{index .id 9}}{{else}}{{.script}}{{end}}`,
+		NoLogFiles:         true,
+		IgnoreFailures:     true,
+		Jobs:               3,
+		AnnotateFile:       annotateFile,
+		ResultsOutputLimit: defaultResultsOutputLimit,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	file, err := os.Open(annotateFile)
+	if err != nil {
+		t.Fatalf("Failed to open annotate file: %v", err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read annotate file: %v", err)
+	}
+
+	expectedHeader := []string{"zone", "script", "id", "xrun_status", "xrun_exit_code", "xrun_duration_ms", "xrun_stdout", "xrun_error"}
+	if !reflect.DeepEqual(records[0], expectedHeader) {
+		t.Fatalf("Expected header %v, got %v", expectedHeader, records[0])
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 3 rows, got %d: %v", len(records)-1, records[1:])
+	}
+
+	first := records[1]
+	if first[0] != "b" || first[3] != "succeeded" || first[4] != "0" || first[6] != "first\n" || first[7] != "" {
+		t.Errorf("Unexpected first row: %q", first)
+	}
+	if first[5] == "" {
+		t.Error("Expected a duration for the first row")
+	}
+
+	second := records[2]
+	if second[0] != "a" || second[3] != "failed" || second[4] != "4" || second[6] != "second\n" || second[7] != "exit status 4" {
+		t.Errorf("Unexpected second row: %q", second)
+	}
+
+	third := records[3]
+	if third[0] != "c" || third[3] != "template_error" || third[4] != "" || third[5] != "" || third[7] != "template_error" {
+		t.Errorf("Unexpected third row: %q", third)
+	}
+}
+
+func TestProcessDataFileAnnotateJSONL(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.jsonl")
+	jsonlContent := `{"id": 1, "tags": ["x"]}
+not json
+{"id": 2, "xrun_status": "stale"}
+`
+	if err := os.WriteFile(dataFile, []byte(jsonlContent), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	annotateFile := filepath.Join(dir, "out.jsonl")
+	config := Config{
+		DataFile:       dataFile,
+		Template:       "echo {{.id}}",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		AnnotateFile:   annotateFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(annotateFile)
+	if err != nil {
+		t.Fatalf("Failed to read annotate file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected the 2 readable rows, got %d: %q", len(lines), lines)
+	}
+
+	var rows []map[string]any
+	for _, line := range lines {
+		var row map[string]any
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("Invalid annotate line %q: %v", line, err)
+		}
+		rows = append(rows, row)
+	}
+
+	if rows[0]["id"] != float64(1) || !reflect.DeepEqual(rows[0]["tags"], []any{"x"}) {
+		t.Errorf("Expected input values to be kept, got %v", rows[0])
+	}
+	if rows[0]["xrun_exit_code"] != float64(0) || rows[0]["xrun_stdout"] != "1\n" || rows[0]["xrun_status"] != "succeeded" {
+		t.Errorf("Unexpected annotations: %v", rows[0])
+	}
+	if rows[1]["xrun_status"] != "succeeded" {
+		t.Errorf("Expected existing xrun_status to be replaced, got %v", rows[1]["xrun_status"])
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVDialect(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		dialect       csvDialect
+		content       string
+		expected      []string
+		expectedCount int
+		expectError   bool
+	}{
+		{
+			name:          "semicolon delimiter",
+			format:        "csv",
+			dialect:       csvDialect{comma: ';'},
+			content:       "id;amount\n1;3,50\n",
+			expected:      []string{"1 [id amount] map[amount:3,50 id:1]"},
+			expectedCount: 1,
+		},
+		{
+			name:          "comment lines are skipped",
+			format:        "csv",
+			dialect:       csvDialect{comment: '#'},
+			content:       "# exported today\nid,name\n# draft\n1,Anna\n",
+			expected:      []string{"1 [id name] map[id:1 name:Anna]"},
+			expectedCount: 1,
+		},
+		{
+			name:          "no header names columns by position",
+			format:        "tsv",
+			dialect:       csvDialect{noHeader: true},
+			content:       "1\tAnna\n2\tBen\n",
+			expected:      []string{"1 [c1 c2] map[c1:1 c2:Anna]", "2 [c1 c2] map[c1:2 c2:Ben]"},
+			expectedCount: 2,
+		},
+		{
+			name:          "no header with column names",
+			format:        "csv",
+			dialect:       csvDialect{noHeader: true, columns: []string{"id", "name"}},
+			content:       "1,Anna\n",
+			expected:      []string{"1 [id name] map[id:1 name:Anna]"},
+			expectedCount: 1,
+		},
+		{
+			name:          "columns replace the header line",
+			format:        "csv",
+			dialect:       csvDialect{columns: []string{"id", "name"}},
+			content:       "ID,Full Name\n1,Anna\n",
+			expected:      []string{"1 [id name] map[id:1 name:Anna]"},
+			expectedCount: 1,
+		},
+		{
+			name:          "lazy quotes",
+			format:        "csv",
+			dialect:       csvDialect{lazyQuotes: true},
+			content:       "id,size\n1,12\" pipe\n",
+			expected:      []string{"1 [id size] map[id:1 size:12\" pipe]"},
+			expectedCount: 1,
+		},
+		{
+			name:          "variable fields",
+			format:        "csv",
+			dialect:       csvDialect{variableFields: true},
+			content:       "id,name,city\n1,Anna\n2,Ben,Oslo,extra\n",
+			expected:      []string{"1 [id name city] map[id:1 name:Anna]", "2 [id name city c4] map[c4:extra city:Oslo id:2 name:Ben]"},
+			expectedCount: 2,
+		},
+		{
+			name:          "trim leading space",
+			format:        "csv",
+			dialect:       csvDialect{trimLeadingSpace: true},
+			content:       "id, name\n1,  Anna\n",
+			expected:      []string{"1 [id name] map[id:1 name:Anna]"},
+			expectedCount: 1,
+		},
+		{
+			name:        "comment must differ from the delimiter",
+			format:      "csv",
+			dialect:     csvDialect{comma: ';', comment: ';'},
+			expectError: true,
+		},
+		{
+			name:        "json data cannot use CSV options",
+			format:      "json",
+			dialect:     csvDialect{noHeader: true},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := applyCSVDialect(formats[tt.format], tt.dialect)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			rows, err := readAllRows(t, format, tt.content)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for _, row := range rows {
+				got = append(got, fmt.Sprintf("%d %v %v", row.Index, row.Fields, row.Values))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows %q, got %q", tt.expected, got)
+			}
+
+			count, err := format.Count(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Failed to count rows: %v", err)
+			}
+			if count != tt.expectedCount {
+				t.Errorf("Expected %d rows to be counted, got %d", tt.expectedCount, count)
+			}
+		})
+	}
+}
+
+func TestApplyCSVDialectKeepsFormatWithoutOptions(t *testing.T) {
+	format, err := applyCSVDialect(formats["json"], csvDialect{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if format != formats["json"] {
+		t.Errorf("Expected the format to be returned unchanged")
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    rune
+		expectError bool
+	}{
+		{input: ";", expected: ';'},
+		{input: "|", expected: '|'},
+		{input: `\t`, expected: '\t'},
+		{input: "tab", expected: '\t'},
+		{input: "\t", expected: '\t'},
+		{input: "§", expected: '§'},
+		{input: ",,", expectError: true},
+		{input: `"`, expectError: true},
+		{input: "\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			delimiter, err := parseDelimiter(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for %q", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if delimiter != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, delimiter)
+			}
+		})
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := parseColumns("id, name ,city")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(columns, "|") != "id|name|city" {
+		t.Errorf("Expected id, name and city, got %q", columns)
+	}
+	if _, err := parseColumns("id,,city"); err == nil {
+		t.Errorf("Expected an error for an empty column name")
+	}
+}
+
+func TestProcessDataFileWithCSVDialect(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "export.txt")
+	if err := os.WriteFile(dataFile, []byte("# generated\n1;Anna\n2;Ben\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	failedFile := filepath.Join(dir, "failed.txt")
+	config := Config{
+		DataFile:       dataFile,
+		Format:         autoFormat,
+		CSV:            csvDialect{comma: ';', comment: '#', noHeader: true, columns: []string{"id", "name"}},
+		Template:       "test {{.name}} = Anna",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		FailedRowsFile: failedFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The failed rows file is written in the data file's dialect, which the
+	// manifest records so that it can be rerun without the CSV options
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "2;Ben\n" {
+		t.Errorf("Expected the failed row without a header, got %q", string(content))
+	}
+	manifest, err := readRerunManifest(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest.CSV == nil || manifest.CSV.Delimiter != ";" || !manifest.CSV.NoHeader || strings.Join(manifest.CSV.Columns, ",") != "id,name" {
+		t.Errorf("Expected the dialect in the manifest, got %+v", manifest.CSV)
+	}
+}
+
+func TestOutputFilesKeepCSVDialect(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "scores.csv")
+	if err := os.WriteFile(dataFile, []byte("id;name\n1;Anna\n2;Ben\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	failedFile := filepath.Join(dir, "failed.csv")
+	annotateFile := filepath.Join(dir, "annotated.csv")
+	config := Config{
+		DataFile:       dataFile,
+		CSV:            csvDialect{comma: ';'},
+		Template:       "test {{.name}} = Anna",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		FailedRowsFile: failedFile,
+		AnnotateFile:   annotateFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "id;name\n2;Ben\n" {
+		t.Errorf("Expected the failed row separated by semicolons, got %q", string(content))
+	}
+	annotated, err := os.ReadFile(annotateFile)
+	if err != nil {
+		t.Fatalf("Failed to read annotate file: %v", err)
+	}
+	if !strings.HasPrefix(string(annotated), "id;name;xrun_status;") {
+		t.Errorf("Expected the annotate file separated by semicolons, got %q", string(annotated))
+	}
+
+	// The manifest lets rerun read the .csv file with its delimiter
+	manifest, err := readRerunManifest(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest.CSV == nil || manifest.CSV.Delimiter != ";" || manifest.CSV.NoHeader {
+		t.Errorf("Expected the delimiter in the manifest, got %+v", manifest.CSV)
+	}
+}
+
+func TestOutputFilesWithVariableFields(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "scores.csv")
+	if err := os.WriteFile(dataFile, []byte("id,name\n1,Anna\n2,Ben\n3,Cy,late\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	failedFile := filepath.Join(dir, "failed.csv")
+	annotateFile := filepath.Join(dir, "annotated.csv")
+	config := Config{
+		DataFile:       dataFile,
+		CSV:            csvDialect{variableFields: true},
+		Template:       "test {{.name}} = Anna",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		FailedRowsFile: failedFile,
+		AnnotateFile:   annotateFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The header names the extra field of a later row
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "id,name,c3\n2,Ben,\n3,Cy,late\n" {
+		t.Errorf("Expected the failed rows with every field, got %q", string(content))
+	}
+	annotated, err := os.ReadFile(annotateFile)
+	if err != nil {
+		t.Fatalf("Failed to read annotate file: %v", err)
+	}
+	header, _, _ := strings.Cut(string(annotated), "\n")
+	if header != "id,name,"+strings.Join(annotateColumns, ",")+",c3" {
+		t.Errorf("Expected the annotate header to name every field, got %q", header)
+	}
+	if !strings.HasSuffix(string(annotated), ",late\n") {
+		t.Errorf("Expected the extra field in the annotate file, got %q", string(annotated))
+	}
+
+	manifest, err := readRerunManifest(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest.CSV == nil || !manifest.CSV.VariableFields || manifest.CSV.Delimiter != "" {
+		t.Errorf("Expected variable fields in the manifest, got %+v", manifest.CSV)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// defaultEncoding reads data as UTF-8, switching to UTF-16 when the data
+// starts with a UTF-16 byte order mark
+const defaultEncoding = "utf-8"
+
+// encodings are the character encodings data can be converted from, besides
+// defaultEncoding. A byte order mark at the start of UTF-16 data overrides
+// the byte order given by the name.
+var encodings = map[string]encoding.Encoding{
+	"utf-16le":  unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16be":  unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"shift_jis": japanese.ShiftJIS,
+	"latin-1":   charmap.ISO8859_1,
+}
+
+// encodingAliases maps other common names to the names in encodings
+var encodingAliases = map[string]string{
+	"utf8":        defaultEncoding,
+	"utf16le":     "utf-16le",
+	"utf16be":     "utf-16be",
+	"sjis":        "shift_jis",
+	"shift-jis":   "shift_jis",
+	"shiftjis":    "shift_jis",
+	"cp932":       "shift_jis",
+	"windows-31j": "shift_jis",
+	"latin1":      "latin-1",
+	"iso-8859-1":  "latin-1",
+	"iso8859-1":   "latin-1",
+}
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// parseEncoding returns the canonical name of the encoding called name
+func parseEncoding(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := encodingAliases[name]; ok {
+		name = alias
+	}
+	if _, ok := encodings[name]; ok || name == defaultEncoding {
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (expected utf-8, utf-16le, utf-16be, shift_jis or latin-1)", name)
+}
+
+// decodingReader converts data to UTF-8 and removes a leading byte order
+// mark. The start of the data is only inspected on the first read, so that
+// opening a data command does not wait for its output.
+type decodingReader struct {
+	r        *bufio.Reader
+	encoding string
+	decoded  io.Reader
+}
+
+func newDecodingReader(r io.Reader, encoding string) *decodingReader {
+	return &decodingReader{r: bufio.NewReader(r), encoding: encoding}
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.decoded == nil {
+		d.decoded = decode(d.r, d.encoding)
+	}
+	return d.decoded.Read(p)
+}
+
+// decode returns r converted from encoding to UTF-8, without a byte order mark
+func decode(r *bufio.Reader, name string) io.Reader {
+	if enc, ok := encodings[name]; ok {
+		return enc.NewDecoder().Reader(r)
+	}
+
+	prefix, _ := r.Peek(len(utf8BOM))
+	switch {
+	case bytes.HasPrefix(prefix, utf8BOM):
+		r.Discard(len(utf8BOM))
+	case bytes.HasPrefix(prefix, utf16LEBOM), bytes.HasPrefix(prefix, utf16BEBOM):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Reader(r)
+	}
+	return r
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) string {
+	t.Helper()
+	encoded, err := enc.NewEncoder().String(s)
+	if err != nil {
+		t.Fatalf("Failed to encode %q: %v", s, err)
+	}
+	return encoded
+}
+
+func TestDataEncodings(t *testing.T) {
+	utf16LE := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	utf16BE := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+
+	tests := []struct {
+		name     string
+		file     string
+		encoding string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "utf-8 byte order mark is removed from the first header",
+			file:     "users.csv",
+			content:  "\xEF\xBB\xBFuser_id,name\n1,Anna\n",
+			expected: []string{"map[name:Anna user_id:1]"},
+		},
+		{
+			name:     "utf-8 byte order mark before json",
+			file:     "users.json",
+			content:  "\xEF\xBB\xBF[{\"user_id\": 1}]",
+			expected: []string{"map[user_id:1]"},
+		},
+		{
+			name:     "utf-8 byte order mark before a sniffed format",
+			file:     "users.txt",
+			content:  "\xEF\xBB\xBF{\"user_id\": 1}\n",
+			expected: []string{"map[user_id:1]"},
+		},
+		{
+			name:     "utf-16 byte order mark is detected",
+			file:     "users.txt",
+			content:  encode(t, utf16LE, "\uFEFFuser_id\tname\n1\tAnna\n"),
+			expected: []string{"map[name:Anna user_id:1]"},
+		},
+		{
+			name:     "utf-16be without byte order mark",
+			file:     "users.csv",
+			encoding: "utf-16be",
+			content:  encode(t, utf16BE, "user_id,name\n1,Zoë\n"),
+			expected: []string{"map[name:Zoë user_id:1]"},
+		},
+		{
+			name:     "utf-16le byte order mark is removed",
+			file:     "users.jsonl",
+			encoding: "utf-16le",
+			content:  encode(t, utf16LE, "\uFEFF{\"user_id\": 1}\n"),
+			expected: []string{"map[user_id:1]"},
+		},
+		{
+			name:     "shift_jis",
+			file:     "users.csv",
+			encoding: "shift_jis",
+			content:  encode(t, japanese.ShiftJIS, "user_id,名前\n1,山田\n"),
+			expected: []string{"map[user_id:1 名前:山田]"},
+		},
+		{
+			name:     "latin-1",
+			file:     "users.csv",
+			encoding: "latin-1",
+			content:  encode(t, charmap.ISO8859_1, "user_id,city\n1,Zürich\n"),
+			expected: []string{"map[city:Zürich user_id:1]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataFile := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(dataFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write data file: %v", err)
+			}
+			encoding := tt.encoding
+			if encoding == "" {
+				encoding = defaultEncoding
+			}
+
+			in, err := openDataFile(dataFile, encoding)
+			if err != nil {
+				t.Fatalf("Failed to open data file: %v", err)
+			}
+			defer in.Close()
+			format, err := resolveFormat(in, autoFormat)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			source, err := format.Open(in.reader)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for {
+				row, err := source.Next()
+				if err != nil {
+					break
+				}
+				got = append(got, fmt.Sprint(stringValues(row.Values)))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows %q, got %q", tt.expected, got)
+			}
+
+			if total := countRows(dataFile, encoding, format.Count, false); total.get() != len(tt.expected) {
+				t.Errorf("Expected %d rows to be counted, got %d", len(tt.expected), total.get())
+			}
+		})
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{input: "utf-8", expected: "utf-8"},
+		{input: "UTF8", expected: "utf-8"},
+		{input: "UTF-16LE", expected: "utf-16le"},
+		{input: "utf16be", expected: "utf-16be"},
+		{input: "Shift_JIS", expected: "shift_jis"},
+		{input: "sjis", expected: "shift_jis"},
+		{input: "ISO-8859-1", expected: "latin-1"},
+		{input: "ebcdic", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			name, err := parseEncoding(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for %q", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestProcessDataFileFromDataCommandWithEncoding(t *testing.T) {
+	config := Config{
+		DataCommand: `printf 'id,city\n1,Z\374rich\n'`,
+		Encoding:    "latin-1",
+		Template:    "test {{.city}} = Zürich",
+		NoLogFiles:  true,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
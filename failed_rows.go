@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rowFileWriter writes rows to a data file in the given format, creating the
+// file on the first row. It is not safe for concurrent use.
+type rowFileWriter struct {
+	path    string
+	format  *Format
+	file    *os.File
+	encoder rowEncoder
+	count   int
+}
+
+// write appends row, creating the file on the first call
+func (w *rowFileWriter) write(row Row) error {
+	if w.file == nil {
+		file, err := os.Create(w.path)
+		if err != nil {
+			return err
+		}
+		w.file = file
+		w.encoder = w.format.NewEncoder(file)
+	}
+
+	if err := w.encoder.Encode(row); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// close finishes the file, reporting whether one was written at all
+func (w *rowFileWriter) close() (bool, error) {
+	if w.file == nil {
+		return false, nil
+	}
+	if err := w.encoder.Close(); err != nil {
+		w.file.Close()
+		return true, err
+	}
+	return true, w.file.Close()
+}
+
+// failedRowsWriter writes rows that did not succeed to a data file in the
+// same format as the input, so that they can be run again. It is safe for
+// concurrent use.
+type failedRowsWriter struct {
+	mu    sync.Mutex
+	path  string
+	rows  rowFileWriter
+	count int
+}
+
+func newFailedRowsWriter(path string, format *Format) *failedRowsWriter {
+	return &failedRowsWriter{path: path, rows: rowFileWriter{path: path, format: format}}
+}
+
+// write appends row, creating the file on the first call
+func (w *failedRowsWriter) write(row Row) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.rows.write(row); err != nil {
+		return err
+	}
+	w.count = w.rows.count
+	return nil
+}
+
+// Close finishes the file and writes the rerun manifest next to it. When no
+// rows failed, any file left at the path by an earlier run is removed instead.
+func (w *failedRowsWriter) Close(manifest rerunManifest) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	written, err := w.rows.close()
+	if err != nil {
+		return err
+	}
+	if !written {
+		for _, path := range []string{w.path, manifestPath(w.path)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeRerunManifest(w.path, manifest)
+}
+
+// rerunManifest is stored next to a failed rows file so that `xrun rerun`
+// can run those rows with the same template
+type rerunManifest struct {
+	Template string `json:"template"`
+	Source   string `json:"source"`
+	// Format is the format given with --format, if any
+	Format string `json:"format,omitempty"`
+	// CSV is the dialect the failed rows were written in, if it is not the
+	// default of their format
+	CSV *manifestCSV `json:"csv,omitempty"`
+	// Strict records --strict
+	Strict bool `json:"strict,omitempty"`
+	// AutoEscape records --auto-escape, if values were escaped
+	AutoEscape string `json:"auto_escape,omitempty"`
+	// Vars are the variables given with -v and --vars, and VarConflict
+	// records --var-conflict unless it was the default
+	Vars        map[string]any `json:"vars,omitempty"`
+	VarConflict string         `json:"var_conflict,omitempty"`
+}
+
+// manifestCSV records what is needed to read back a delimiter-separated
+// failed rows file
+type manifestCSV struct {
+	Delimiter string   `json:"delimiter,omitempty"`
+	NoHeader  bool     `json:"no_header,omitempty"`
+	Columns   []string `json:"columns,omitempty"`
+	// VariableFields records --variable-fields
+	VariableFields bool `json:"variable_fields,omitempty"`
+}
+
+// newManifestCSV returns the manifest entry for failed rows written in
+// format, or nil if it is not delimiter-separated or reads back without one
+func newManifestCSV(format *Format) *manifestCSV {
+	if format.csv == nil {
+		return nil
+	}
+	var entry manifestCSV
+	if registered, ok := formats[format.Name]; !ok || registered.csv == nil || registered.csv.comma != format.csv.comma {
+		entry.Delimiter = string(format.csv.comma)
+	}
+	if format.csv.noHeader {
+		entry.NoHeader = true
+		entry.Columns = format.csv.columns
+	}
+	entry.VariableFields = format.csv.variableFields
+	if entry.Delimiter == "" && !entry.NoHeader && !entry.VariableFields {
+		return nil
+	}
+	return &entry
+}
+
+// manifestPath returns where the manifest for a failed rows file is stored
+func manifestPath(failedRowsFile string) string {
+	return failedRowsFile + ".xrun.json"
+}
+
+func writeRerunManifest(failedRowsFile string, manifest rerunManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath(failedRowsFile), append(data, '\n'), 0644)
+}
+
+func readRerunManifest(failedRowsFile string) (rerunManifest, error) {
+	var manifest rerunManifest
+	data, err := os.ReadFile(manifestPath(failedRowsFile))
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read rerun manifest (was %s written by --failed-rows?): %v", failedRowsFile, err)
+	}
+	// Numbers in variables are kept as written
+	if err := unmarshalJSON(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to parse rerun manifest: %v", err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFailedRowsWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		rows     []Row
+		expected string
+	}{
+		{
+			name:   "CSV keeps header order",
+			format: "csv",
+			rows: []Row{
+				{Fields: []string{"user_id", "name"}, Values: map[string]any{"user_id": "3", "name": "O'Brien, Pat"}},
+				{Fields: []string{"user_id", "name"}, Values: map[string]any{"user_id": "7"}},
+			},
+			expected: "user_id,name\n3,\"O'Brien, Pat\"\n7,\n",
+		},
+		{
+			name:   "JSON array",
+			format: "json",
+			rows: []Row{
+				{Values: map[string]any{"id": float64(1), "tags": []any{"a"}}},
+				{Values: map[string]any{"id": float64(2)}},
+			},
+			expected: "[\n  {\"id\":1,\"tags\":[\"a\"]},\n  {\"id\":2}\n]\n",
+		},
+		{
+			name:   "JSON Lines",
+			format: "jsonl",
+			rows: []Row{
+				{Values: map[string]any{"id": float64(1)}},
+				{Values: map[string]any{"id": float64(2)}},
+			},
+			expected: "{\"id\":1}\n{\"id\":2}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "failed."+tt.format)
+			w := newFailedRowsWriter(path, formats[tt.format])
+			for _, row := range tt.rows {
+				if err := w.write(row); err != nil {
+					t.Fatalf("Failed to write row: %v", err)
+				}
+			}
+			if err := w.Close(rerunManifest{Template: "echo {{.id}}"}); err != nil {
+				t.Fatalf("Failed to close writer: %v", err)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read failed rows file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+
+			manifest, err := readRerunManifest(path)
+			if err != nil {
+				t.Fatalf("Failed to read manifest: %v", err)
+			}
+			if manifest.Template != "echo {{.id}}" {
+				t.Errorf("Expected template to be recorded, got %q", manifest.Template)
+			}
+		})
+	}
+}
+
+func TestFailedRowsWriterRemovesStaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.csv")
+	for _, stale := range []string{path, manifestPath(path)} {
+		if err := os.WriteFile(stale, []byte("stale"), 0644); err != nil {
+			t.Fatalf("Failed to write stale file: %v", err)
+		}
+	}
+
+	if err := newFailedRowsWriter(path, formats["csv"]).Close(rerunManifest{}); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	for _, stale := range []string{path, manifestPath(path)} {
+		if _, err := os.Stat(stale); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed when no rows failed", stale)
+		}
+	}
+}
+
+func TestProcessDataFileFailedRowsRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile := filepath.Join(tmpDir, "users.csv")
+	failedFile := filepath.Join(tmpDir, "failed.csv")
+
+	csvContent := "id,name\n1,Alice\n2,Bob\n3,Carol\n"
+	if err := os.WriteFile(dataFile, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	vars, err := templateVariables(map[string]any{"skip": json.Number("2"), "tags": []any{"a"}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config := Config{
+		DataFile:       dataFile,
+		Template:       "test {{.id}} != {{.skip}}",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		FailedRowsFile: failedFile,
+		Strict:         true,
+		AutoEscape:     autoEscapeShell,
+		Vars:           vars,
+		VarConflict:    varConflictError,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "id,name\n2,Bob\n" {
+		t.Errorf("Unexpected failed rows file: %q", string(content))
+	}
+
+	manifest, err := readRerunManifest(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest.Template != config.Template || manifest.Source != dataFile || !manifest.Strict || manifest.AutoEscape != autoEscapeShell {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+	if fmt.Sprint(manifest.Vars) != "map[skip:2 tags:[a]]" || manifest.VarConflict != varConflictError {
+		t.Errorf("Expected the variables in the manifest, got %v and %q", manifest.Vars, manifest.VarConflict)
+	}
+	if _, ok := manifest.Vars["skip"].(json.Number); !ok {
+		t.Errorf("Expected numbers to be kept as written, got %T", manifest.Vars["skip"])
+	}
+
+	config.FailedRowsFile = filepath.Join(tmpDir, "failed.json")
+	if err := processDataFile(config); err == nil {
+		t.Error("Expected error for a failed rows file in a different format")
+	}
+}
+
+func TestProcessDataFileReadErrorAfterRows(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile := filepath.Join(tmpDir, "users.csv")
+	failedFile := filepath.Join(tmpDir, "failed.csv")
+	annotateFile := filepath.Join(tmpDir, "annotated.csv")
+
+	// The third row has too many fields, which ends reading the file
+	csvContent := "id,name\n1,Alice\n2,Bob\n3,Carol,extra\n4,Dave\n"
+	if err := os.WriteFile(dataFile, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	config := Config{
+		DataFile:       dataFile,
+		Template:       "test {{.id}} != 2",
+		NoLogFiles:     true,
+		FailedRowsFile: failedFile,
+		AnnotateFile:   annotateFile,
+	}
+	err := processDataFile(config)
+	var rowErr *RowFailureError
+	if !errors.As(err, &rowErr) || !strings.Contains(err.Error(), "wrong number of fields") {
+		t.Fatalf("Expected a row failure error reporting the read error, got %v", err)
+	}
+	if rowErr.Failed != 1 || rowErr.Total != 2 {
+		t.Errorf("Expected 1 of 2 rows failed, got %+v", rowErr)
+	}
+
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "id,name\n2,Bob\n" {
+		t.Errorf("Unexpected failed rows file: %q", string(content))
+	}
+	if _, err := readRerunManifest(failedFile); err != nil {
+		t.Errorf("Expected the manifest to be written: %v", err)
+	}
+	if content, err := os.ReadFile(annotateFile); err != nil || strings.Count(string(content), "\n") != 3 {
+		t.Errorf("Expected the annotate file to hold both rows, got %q, %v", content, err)
+	}
+}
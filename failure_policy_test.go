@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFailurePolicyExceeded(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   FailurePolicy
+		failed   int
+		finished int
+		total    int
+		expected bool
+	}{
+		{name: "zero policy never aborts", policy: FailurePolicy{}, failed: 50, finished: 50, total: 50, expected: false},
+		{name: "fail fast on first failure", policy: FailurePolicy{FailFast: true}, failed: 1, finished: 1, total: 50, expected: true},
+		{name: "fail fast without failures", policy: FailurePolicy{FailFast: true}, failed: 0, finished: 10, total: 50, expected: false},
+		{name: "below max failures", policy: FailurePolicy{MaxFailures: 3}, failed: 2, finished: 10, total: 50, expected: false},
+		{name: "at max failures", policy: FailurePolicy{MaxFailures: 3}, failed: 3, finished: 10, total: 50, expected: true},
+		{name: "rate before minimum sample", policy: FailurePolicy{MaxFailureRate: 0.1}, failed: 2, finished: 2, total: 50, expected: false},
+		{name: "rate above threshold", policy: FailurePolicy{MaxFailureRate: 0.1}, failed: 2, finished: 10, total: 50, expected: true},
+		{name: "rate at threshold", policy: FailurePolicy{MaxFailureRate: 0.2}, failed: 2, finished: 10, total: 50, expected: false},
+		{name: "rate with small data file", policy: FailurePolicy{MaxFailureRate: 0.5}, failed: 3, finished: 4, total: 4, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, exceeded := tt.policy.exceeded(tt.failed, tt.finished, tt.total)
+			if exceeded != tt.expected {
+				t.Errorf("Expected exceeded=%v, got %v", tt.expected, exceeded)
+			}
+		})
+	}
+}
+
+func TestParseFailureRate(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    float64
+		expectError bool
+	}{
+		{input: "5%", expected: 0.05},
+		{input: "12.5", expected: 0.125},
+		{input: "abc", expectError: true},
+		{input: "150%", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rate, err := parseFailureRate(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rate != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, rate)
+			}
+		})
+	}
+}
+
+func TestRunnerFailFast(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	var csvContent strings.Builder
+	csvContent.WriteString("id\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&csvContent, "%d\n", i)
+	}
+	if _, err := tmpFile.WriteString(csvContent.String()); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	var executedCommands []string
+	mockExecutor := func(ctx context.Context, command string, progress Progress) error {
+		executedCommands = append(executedCommands, command)
+		if progress.Current >= 3 {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	r := newContextRunner(mockExecutor, 1)
+	r.policy = FailurePolicy{MaxFailures: 2}
+	if err := processDataFileWithRunner(tmpFile.Name(), "echo {{.id}}", r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(executedCommands) != 4 {
+		t.Errorf("Expected 4 commands before aborting, got %d: %v", len(executedCommands), executedCommands)
+	}
+	if !r.aborted() {
+		t.Error("Expected run to be aborted")
+	}
+	if r.abortCause() != "--max-failures 2 reached" {
+		t.Errorf("Expected abort reason %q, got %q", "--max-failures 2 reached", r.abortCause())
+	}
+
+	var buf strings.Builder
+	r.summary.Print(&buf)
+	if !strings.Contains(buf.String(), "2 succeeded, 2 failed, 0 timed out, 0 template errors, 6 skipped") {
+		t.Errorf("Unexpected summary: %q", buf.String())
+	}
+}
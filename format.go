@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Row is a row read from a RowSource
+type Row struct {
+	// Index is the 1-based position of the row in its source
+	Index int
+	// Fields is the column order for formats that have one, such as CSV
+	Fields []string
+	// Values holds the row's values, typed as the format decodes them
+	Values map[string]any
+	// Err is set instead of Values for a row that could not be parsed. The
+	// source can still be read past it.
+	Err error
+}
+
+// RowSource reads the rows of a data file one at a time
+type RowSource interface {
+	// Next returns the next row, or io.EOF once all rows have been read. Any
+	// other error means the rest of the source cannot be read.
+	Next() (Row, error)
+}
+
+// rowEncoder writes rows in a format to an underlying writer
+type rowEncoder interface {
+	Encode(row Row) error
+	// Close finishes the document without closing the underlying writer
+	Close() error
+}
+
+// Format describes how a data file format is read and written
+type Format struct {
+	// Name identifies the format in messages
+	Name string
+	// Extensions are the lower-case file extensions, including the dot,
+	// that are read in this format
+	Extensions []string
+	// Open returns a RowSource reading the rows in r
+	Open func(r io.Reader) (RowSource, error)
+	// Count counts the rows in r without holding them in memory
+	Count func(r io.Reader) (int, error)
+	// NewEncoder returns an encoder writing rows in this format to w, for
+	// the failed rows and annotate files
+	NewEncoder func(w io.Writer) rowEncoder
+
+	// csv is the dialect of delimiter-separated formats, which can be
+	// adjusted from the command line, and nil for other formats
+	csv *csvDialect
+	// xlsx selects the cells read from spreadsheet formats, and is nil for
+	// other formats
+	xlsx *xlsxOptions
+	// root returns the format reading the rows at a path inside each
+	// document, for formats holding nested documents, and is nil for others
+	root func(path rowPath) *Format
+}
+
+// autoFormat is the --format value choosing the format by the data file's
+// extension, or by its contents when the extension is not registered
+const autoFormat = "auto"
+
+// sniffSampleSize is the most of a data file looked at to guess its format
+const sniffSampleSize = 64 * 1024
+
+// sniffLines is the number of lines looked at to guess a file's delimiter
+const sniffLines = 10
+
+// zipMagic starts zip archives such as .xlsx workbooks
+var zipMagic = []byte("PK\x03\x04")
+
+// sniffDelimiters are the field delimiters recognised in delimiter-separated files
+var sniffDelimiters = []rune{',', '\t', ';', '|'}
+
+var (
+	formats          = make(map[string]*Format)
+	formatExtensions = make(map[string]*Format)
+)
+
+// registerFormat makes format available by name and by its extensions
+func registerFormat(format *Format) {
+	if _, ok := formats[format.Name]; ok {
+		panic(fmt.Sprintf("format %s registered twice", format.Name))
+	}
+	formats[format.Name] = format
+	for _, ext := range format.Extensions {
+		formatExtensions[ext] = format
+	}
+}
+
+// lookupFormat returns the format registered under name
+func lookupFormat(name string) (*Format, error) {
+	format, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (expected one of %s)", name, strings.Join(formatNames(), ", "))
+	}
+	return format, nil
+}
+
+// formatNames returns the names of all registered formats, sorted
+func formatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extensionFormat returns the format registered for path's extension
+func extensionFormat(path string) (*Format, bool) {
+	format, ok := formatExtensions[strings.ToLower(filepath.Ext(path))]
+	return format, ok
+}
+
+// resolveFormat returns the format to read in in: the format called name, or
+// with autoFormat the format registered for the data file's extension,
+// falling back to sniffing the start of the input
+func resolveFormat(in *dataInput, name string) (*Format, error) {
+	if name != "" && name != autoFormat {
+		return lookupFormat(name)
+	}
+	if format, ok := extensionFormat(in.path); ok {
+		return format, nil
+	}
+
+	sample, err := in.sample()
+	if err != nil {
+		return nil, err
+	}
+	return sniffFormat(sample), nil
+}
+
+// sniffComplete reports whether sample is enough for sniffFormat
+func sniffComplete(sample []byte) bool {
+	if bytes.HasPrefix(sample, zipMagic) {
+		return true
+	}
+	text := bytes.TrimLeft(sample, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(text, []byte("[")):
+		// [[ may start a TOML array of tables, told apart by what follows
+		return len(text) > 1 && (text[1] != '[' || len(bytes.TrimLeft(text[2:], " \t")) > 0)
+	case bytes.HasPrefix(text, []byte("{")):
+		// JSON Lines are told apart from a JSON document by the first line
+		return bytes.Contains(text, []byte("\n"))
+	case isYAMLStart(text):
+		return true
+	}
+	return bytes.Count(sample, []byte("\n")) >= sniffLines
+}
+
+// isTOMLStart reports whether text starts with a TOML array of tables header
+// such as [[hosts]]
+func isTOMLStart(text []byte) bool {
+	if !bytes.HasPrefix(text, []byte("[[")) {
+		return false
+	}
+	rest := bytes.TrimLeft(text[2:], " \t")
+	return len(rest) > 0 && (rest[0] == '_' || (rest[0]|0x20 >= 'a' && rest[0]|0x20 <= 'z'))
+}
+
+// isJSONLStart reports whether text, starting with {, has a complete JSON
+// value on its first line, as JSON Lines do, rather than a JSON document
+// spread over several lines. A first line that does not end within the
+// sample is taken for a long JSON Lines record.
+func isJSONLStart(text []byte) bool {
+	line, _, found := bytes.Cut(text, []byte("\n"))
+	return !found || json.Valid(line)
+}
+
+// isYAMLStart reports whether text starts with a YAML document marker or a
+// sequence entry
+func isYAMLStart(text []byte) bool {
+	for _, prefix := range []string{"---", "- ", "-\n", "-\r\n"} {
+		if bytes.HasPrefix(text, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffFormat guesses the format of a data file from its first bytes: a
+// zip archive is an XLSX workbook, [[name]] starts a TOML array of tables, a
+// JSON array starts with [, JSON Lines with a complete object on the first
+// line, any other JSON document with {, a YAML stream with --- or -,
+// and anything else is read as a delimiter-separated file with the delimiter
+// used most consistently
+func sniffFormat(sample []byte) *Format {
+	if bytes.HasPrefix(sample, zipMagic) {
+		return formats["xlsx"]
+	}
+	text := bytes.TrimLeft(sample, " \t\r\n")
+	switch {
+	case isTOMLStart(text):
+		return formats["toml"]
+	case isYAMLStart(text):
+		return formats["yaml"]
+	case bytes.HasPrefix(text, []byte("[")):
+		return formats["json"]
+	case bytes.HasPrefix(text, []byte("{")):
+		if isJSONLStart(text) {
+			return formats["jsonl"]
+		}
+		return formats["json"]
+	}
+
+	switch comma := sniffDelimiter(sample); comma {
+	case ',':
+		return formats["csv"]
+	case '\t':
+		return formats["tsv"]
+	default:
+		return newCSVFormat("csv", nil, csvDialect{comma: comma})
+	}
+}
+
+// sniffDelimiter picks the delimiter of a delimiter-separated sample. A
+// delimiter occurring equally often on every line wins over one that does
+// not; ties go to the delimiter with more fields, then to the earlier one in
+// sniffDelimiters.
+func sniffDelimiter(sample []byte) rune {
+	lines := strings.Split(strings.ReplaceAll(string(sample), "\r\n", "\n"), "\n")
+	if len(lines) > 1 {
+		// The last line is empty or may have been cut off
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > sniffLines {
+		lines = lines[:sniffLines]
+	}
+	var nonEmpty []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			nonEmpty = append(nonEmpty, line)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return ','
+	}
+
+	best, bestCount, bestConsistent := ',', 0, false
+	for _, delimiter := range sniffDelimiters {
+		count := countUnquoted(nonEmpty[0], delimiter)
+		if count == 0 {
+			continue
+		}
+		consistent := true
+		for _, line := range nonEmpty[1:] {
+			if countUnquoted(line, delimiter) != count {
+				consistent = false
+				break
+			}
+		}
+		if (consistent && !bestConsistent) || (consistent == bestConsistent && count > bestCount) {
+			best, bestCount, bestConsistent = delimiter, count, consistent
+		}
+	}
+	return best
+}
+
+// countUnquoted counts the occurrences of r in line outside double quotes
+func countUnquoted(line string, r rune) int {
+	n := 0
+	quoted := false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == r && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// outputFormat returns the format to write path in, for the failed rows and
+// annotate files of a data file read in format. A file whose extension is
+// registered is written in that format, which must be of the same kind as
+// the data file's, keeping the data file's CSV dialect; any other file is
+// written exactly like the data file.
+func outputFormat(path string, format *Format) (*Format, bool) {
+	if other, ok := extensionFormat(path); ok {
+		if other.Name == format.Name && format.csv != nil {
+			return newCSVFormat(other.Name, other.Extensions, *format.csv), true
+		}
+		return other, other.Name == format.Name
+	}
+	return format, true
+}
+
+// stringValues converts a row's typed values to strings, for formats holding
+// only text and for identifying rows in state files
+func stringValues(values map[string]any) map[string]string {
+	stringRow := make(map[string]string, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case nil:
+			stringRow[key] = ""
+		case string:
+			stringRow[key] = v
+		case json.Number:
+			stringRow[key] = v.String()
+		case float64:
+			stringRow[key] = fmt.Sprintf("%g", v)
+		case bool:
+			stringRow[key] = fmt.Sprintf("%t", v)
+		default:
+			// For complex types, convert to JSON string
+			jsonBytes, _ := json.Marshal(v)
+			stringRow[key] = string(jsonBytes)
+		}
+	}
+	return stringRow
+}
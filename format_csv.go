@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	registerFormat(newCSVFormat("csv", []string{".csv"}, csvDialect{comma: ','}))
+	registerFormat(newCSVFormat("tsv", []string{".tsv"}, csvDialect{comma: '\t'}))
+}
+
+// csvDialect describes the flavour of a delimiter-separated file
+type csvDialect struct {
+	// comma is the field delimiter
+	comma rune
+	// comment starts lines that are ignored (0 means none)
+	comment rune
+	// noHeader reads the first line as a row rather than column names
+	noHeader bool
+	// columns names the columns, replacing the header line's names
+	columns []string
+	// lazyQuotes accepts quotes appearing inside unquoted fields
+	lazyQuotes bool
+	// variableFields accepts rows with a different number of fields than
+	// the first line
+	variableFields bool
+	// trimLeadingSpace ignores white space at the start of fields
+	trimLeadingSpace bool
+}
+
+func (d csvDialect) newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = d.comma
+	reader.Comment = d.comment
+	reader.LazyQuotes = d.lazyQuotes
+	reader.TrimLeadingSpace = d.trimLeadingSpace
+	if d.variableFields {
+		reader.FieldsPerRecord = -1
+	}
+	return reader
+}
+
+// isZero reports whether d leaves every setting at its default
+func (d csvDialect) isZero() bool {
+	return d.comma == 0 && d.comment == 0 && !d.noHeader && d.columns == nil &&
+		!d.lazyQuotes && !d.variableFields && !d.trimLeadingSpace
+}
+
+// applyCSVDialect returns format adjusted by the settings in overrides that
+// are not zero. Only delimiter-separated formats can be adjusted.
+func applyCSVDialect(format *Format, overrides csvDialect) (*Format, error) {
+	if overrides.isZero() {
+		return format, nil
+	}
+	if format.csv == nil {
+		return nil, fmt.Errorf("CSV options cannot be used with %s data", format.Name)
+	}
+
+	dialect := *format.csv
+	if overrides.comma != 0 {
+		dialect.comma = overrides.comma
+	}
+	if overrides.comment != 0 {
+		dialect.comment = overrides.comment
+	}
+	if dialect.comment == dialect.comma {
+		return nil, fmt.Errorf("the comment character must differ from the delimiter")
+	}
+	dialect.noHeader = dialect.noHeader || overrides.noHeader
+	if overrides.columns != nil {
+		dialect.columns = overrides.columns
+	}
+	dialect.lazyQuotes = dialect.lazyQuotes || overrides.lazyQuotes
+	dialect.variableFields = dialect.variableFields || overrides.variableFields
+	dialect.trimLeadingSpace = dialect.trimLeadingSpace || overrides.trimLeadingSpace
+	return newCSVFormat(format.Name, format.Extensions, dialect), nil
+}
+
+// parseDelimiter parses a single-character delimiter given on the command
+// line, accepting \t and "tab" for tabs
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	runes := []rune(s)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' || runes[0] == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter %q (expected a single character)", s)
+	}
+	return runes[0], nil
+}
+
+// parseColumns parses a comma-separated list of column names
+func parseColumns(s string) ([]string, error) {
+	var columns []string
+	for _, column := range strings.Split(s, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			return nil, fmt.Errorf("invalid column list %q (column names must not be empty)", s)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// newCSVFormat returns a delimiter-separated format reading files in dialect
+func newCSVFormat(name string, extensions []string, dialect csvDialect) *Format {
+	return &Format{
+		Name:       name,
+		Extensions: extensions,
+		csv:        &dialect,
+		Open: func(r io.Reader) (RowSource, error) {
+			return openCSV(r, dialect)
+		},
+		Count: func(r io.Reader) (int, error) {
+			return countCSVRows(r, dialect)
+		},
+		NewEncoder: func(w io.Writer) rowEncoder {
+			return newCSVEncoder(w, dialect)
+		},
+	}
+}
+
+// csvSource reads the rows of a delimiter-separated file. Columns without a
+// name are called c1, c2, ... after their position.
+type csvSource struct {
+	reader  *csv.Reader
+	headers []string
+	index   int
+}
+
+func openCSV(r io.Reader, dialect csvDialect) (RowSource, error) {
+	reader := dialect.newReader(r)
+	source := &csvSource{reader: reader, headers: dialect.columns}
+	if !dialect.noHeader {
+		headers, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV headers: %v", err)
+		}
+		if source.headers == nil {
+			source.headers = headers
+		}
+	}
+	return source, nil
+}
+
+// fields returns the column names of a record with n fields
+func (s *csvSource) fields(n int) []string {
+	if n <= len(s.headers) {
+		return s.headers
+	}
+	fields := make([]string, n)
+	copy(fields, s.headers)
+	for j := len(s.headers); j < n; j++ {
+		fields[j] = fmt.Sprintf("c%d", j+1)
+	}
+	return fields
+}
+
+func (s *csvSource) Next() (Row, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+	if err != nil {
+		return Row{}, fmt.Errorf("failed to read CSV row: %v", err)
+	}
+
+	fields := s.fields(len(record))
+	values := make(map[string]any, len(fields))
+	for j, field := range fields {
+		if j < len(record) {
+			values[field] = record[j]
+		}
+	}
+	s.index++
+	return Row{Index: s.index, Fields: fields, Values: values}, nil
+}
+
+// countCSVRows counts the records following the header of a CSV file
+func countCSVRows(r io.Reader, dialect csvDialect) (int, error) {
+	reader := dialect.newReader(r)
+	reader.ReuseRecord = true
+	if !dialect.noHeader {
+		if _, err := reader.Read(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+// csvEncoder writes rows as CSV, with the first row's fields as the header
+// unless the dialect has no header line. When rows may have a different
+// number of fields, they are held back until Close so that the header can
+// name the fields of every row.
+type csvEncoder struct {
+	writer   *csv.Writer
+	noHeader bool
+	fields   []string
+	variable bool
+	rows     []Row
+}
+
+func newCSVEncoder(w io.Writer, dialect csvDialect) rowEncoder {
+	writer := csv.NewWriter(w)
+	writer.Comma = dialect.comma
+	return &csvEncoder{writer: writer, noHeader: dialect.noHeader, variable: dialect.variableFields}
+}
+
+func (e *csvEncoder) Encode(row Row) error {
+	if e.variable {
+		e.rows = append(e.rows, row)
+		return nil
+	}
+	if e.fields == nil {
+		e.fields = row.Fields
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if err := e.writeRow(row); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// writeHeader writes the header line unless the dialect has none
+func (e *csvEncoder) writeHeader() error {
+	if e.noHeader {
+		return nil
+	}
+	return e.writer.Write(e.fields)
+}
+
+// writeRow writes the values of row in the order of the header
+func (e *csvEncoder) writeRow(row Row) error {
+	record := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		if value, ok := row.Values[field]; ok && value != nil {
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return e.writer.Write(record)
+}
+
+func (e *csvEncoder) Close() error {
+	if e.variable && len(e.rows) > 0 {
+		// The header holds every field in the order it was first seen
+		seen := make(map[string]bool)
+		for _, row := range e.rows {
+			for _, field := range row.Fields {
+				if !seen[field] {
+					seen[field] = true
+					e.fields = append(e.fields, field)
+				}
+			}
+		}
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+		for _, row := range e.rows {
+			if err := e.writeRow(row); err != nil {
+				return err
+			}
+		}
+		e.rows = nil
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
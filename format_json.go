@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+func init() {
+	registerFormat(newJSONFormat(nil))
+	registerFormat(newJSONLFormat(nil))
+}
+
+// newJSONFormat returns the json format reading the array at root
+func newJSONFormat(root rowPath) *Format {
+	return &Format{
+		Name:       "json",
+		Extensions: []string{".json"},
+		Open: func(r io.Reader) (RowSource, error) {
+			return openJSON(r, root)
+		},
+		Count: func(r io.Reader) (int, error) {
+			return countJSONRows(r, root)
+		},
+		NewEncoder: newJSONEncoder,
+		root:       newJSONFormat,
+	}
+}
+
+// newJSONLFormat returns the jsonl format reading the rows at root in each line
+func newJSONLFormat(root rowPath) *Format {
+	return &Format{
+		Name:       "jsonl",
+		Extensions: []string{".jsonl"},
+		Open: func(r io.Reader) (RowSource, error) {
+			return openJSONL(r, root)
+		},
+		Count: func(r io.Reader) (int, error) {
+			return countJSONLRows(r, root)
+		},
+		NewEncoder: newJSONLEncoder,
+		root:       newJSONLFormat,
+	}
+}
+
+// jsonSource reads the objects of a JSON array one at a time
+type jsonSource struct {
+	decoder *json.Decoder
+	index   int
+}
+
+func openJSON(r io.Reader, root rowPath) (RowSource, error) {
+	decoder := json.NewDecoder(r)
+	// Numbers are kept as written, so that large IDs do not lose precision
+	decoder.UseNumber()
+	if err := readJSONArrayStart(decoder, root); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	return &jsonSource{decoder: decoder}, nil
+}
+
+func (s *jsonSource) Next() (Row, error) {
+	if !s.decoder.More() {
+		return Row{}, io.EOF
+	}
+
+	s.index++
+	var values map[string]any
+	if err := s.decoder.Decode(&values); err != nil {
+		// The decoder skips an element of the wrong type, so the array can
+		// still be read past it
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return Row{Index: s.index, Err: fmt.Errorf("expected a JSON object: %v", err)}, nil
+		}
+		return Row{}, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	if values == nil {
+		return Row{Index: s.index, Err: fmt.Errorf("expected a JSON object, got null")}, nil
+	}
+	return Row{Index: s.index, Values: values}, nil
+}
+
+// readJSONArrayStart consumes the document up to the opening bracket of the
+// array at root, so that its elements can be decoded one at a time
+func readJSONArrayStart(decoder *json.Decoder, root rowPath) error {
+	if err := seekJSON(decoder, root); err != nil {
+		return err
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		if len(root) > 0 {
+			return fmt.Errorf("expected a JSON array of objects at %s, got %v", root, token)
+		}
+		return fmt.Errorf("expected a JSON array of objects, got %v", token)
+	}
+	return nil
+}
+
+// seekJSON consumes the document up to the value at path, skipping the
+// values before it without decoding them
+func seekJSON(decoder *json.Decoder, path rowPath) error {
+	for i, step := range path {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		delim, _ := token.(json.Delim)
+
+		found := false
+		switch {
+		case step.isIndex && delim == '[':
+			for n := 0; n < step.index && decoder.More(); n++ {
+				if err := skipJSONValue(decoder); err != nil {
+					return err
+				}
+			}
+			found = decoder.More()
+		case !step.isIndex && delim == '{':
+			for !found && decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				if found = key == step.key; !found {
+					if err := skipJSONValue(decoder); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s not found", path[:i+1])
+		}
+	}
+	return nil
+}
+
+// skipJSONValue consumes the next value without decoding it
+func skipJSONValue(decoder *json.Decoder) error {
+	var value json.RawMessage
+	return decoder.Decode(&value)
+}
+
+// countJSONRows counts the elements of the JSON array at root without
+// decoding them
+func countJSONRows(r io.Reader, root rowPath) (int, error) {
+	decoder := json.NewDecoder(r)
+	if err := readJSONArrayStart(decoder, root); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for decoder.More() {
+		if err := skipJSONValue(decoder); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// jsonlSource reads one JSON object per non-empty line, or with a root the
+// objects found at root in each line
+type jsonlSource struct {
+	scanner *bufio.Scanner
+	root    rowPath
+	pending []Row
+	line    int
+	index   int
+}
+
+func openJSONL(r io.Reader, root rowPath) (RowSource, error) {
+	return &jsonlSource{scanner: newJSONLScanner(r), root: root}, nil
+}
+
+func (s *jsonlSource) Next() (Row, error) {
+	for len(s.pending) == 0 {
+		if !s.scanner.Scan() {
+			if err := s.scanner.Err(); err != nil {
+				return Row{}, fmt.Errorf("error reading JSONL file: %v", err)
+			}
+			return Row{}, io.EOF
+		}
+		s.line++
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 { // Skip empty lines
+			continue
+		}
+		s.pending = s.lineRows(line)
+	}
+
+	row := s.pending[0]
+	s.pending = s.pending[1:]
+	s.index++
+	row.Index = s.index
+	return row, nil
+}
+
+// lineRows returns the rows of a non-empty line: the line's object, or the
+// object or array of objects at root
+func (s *jsonlSource) lineRows(line []byte) []Row {
+	if len(s.root) == 0 {
+		var values map[string]any
+		if err := unmarshalJSON(line, &values); err != nil {
+			return []Row{{Err: fmt.Errorf("failed to parse JSON on line %d: %v", s.line, err)}}
+		}
+		if values == nil {
+			return []Row{{Err: fmt.Errorf("expected a JSON object on line %d, got null", s.line)}}
+		}
+		return []Row{{Values: values}}
+	}
+
+	var document any
+	if err := unmarshalJSON(line, &document); err != nil {
+		return []Row{{Err: fmt.Errorf("failed to parse JSON on line %d: %v", s.line, err)}}
+	}
+	value, ok := s.root.lookup(document)
+	if !ok {
+		return []Row{{Err: fmt.Errorf("%s not found on line %d", s.root, s.line)}}
+	}
+	elements, ok := value.([]any)
+	if !ok {
+		elements = []any{value}
+	}
+	rows := make([]Row, 0, len(elements))
+	for _, element := range elements {
+		if values, ok := element.(map[string]any); ok {
+			rows = append(rows, Row{Values: values})
+		} else {
+			rows = append(rows, Row{Err: fmt.Errorf("expected a JSON object at %s on line %d, got %s", s.root, s.line, jsonTypeName(element))})
+		}
+	}
+	return rows
+}
+
+// jsonTypeName names the JSON type of a decoded value in messages
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case json.Number, float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case []any:
+		return "an array"
+	}
+	return "an object"
+}
+
+// unmarshalJSON parses data like json.Unmarshal, keeping numbers as written
+func unmarshalJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after the JSON value")
+	}
+	return nil
+}
+
+// countJSONLRows counts the rows jsonlSource reads from r: the non-empty
+// lines, or with a root the objects found in them
+func countJSONLRows(r io.Reader, root rowPath) (int, error) {
+	if len(root) > 0 {
+		source := &jsonlSource{scanner: newJSONLScanner(r), root: root}
+		n := 0
+		for {
+			if _, err := source.Next(); err == io.EOF {
+				return n, nil
+			} else if err != nil {
+				return 0, err
+			}
+			n++
+		}
+	}
+
+	scanner := newJSONLScanner(r)
+	n := 0
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// maxJSONLLineSize is the longest line accepted in a JSON Lines file
+const maxJSONLLineSize = 64 * 1024 * 1024
+
+func newJSONLScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLineSize)
+	return scanner
+}
+
+// jsonEncoder writes rows as the objects of a JSON array
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONEncoder(w io.Writer) rowEncoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) Encode(row Row) error {
+	data, err := json.Marshal(row.Values)
+	if err != nil {
+		return err
+	}
+	separator := "[\n  "
+	if e.count > 0 {
+		separator = ",\n  "
+	}
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// jsonlEncoder writes rows as one JSON object per line
+type jsonlEncoder struct {
+	w io.Writer
+}
+
+func newJSONLEncoder(w io.Writer) rowEncoder {
+	return &jsonlEncoder{w: w}
+}
+
+func (e *jsonlEncoder) Encode(row Row) error {
+	data, err := json.Marshal(row.Values)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e *jsonlEncoder) Close() error {
+	return nil
+}
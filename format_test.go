@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		sample        string
+		expected      string
+		expectedComma rune
+	}{
+		{name: "json array", sample: "  \n[{\"id\": 1}]", expected: "json"},
+		{name: "json lines", sample: "{\"id\": 1}\n{\"id\": 2}\n", expected: "jsonl"},
+		{name: "json lines with a long first line", sample: "{\"id\": 1, \"name\": ", expected: "jsonl"},
+		{name: "pretty-printed json object", sample: "{\n  \"data\": {\"items\": [{\"id\": 1}]}\n}\n", expected: "json"},
+		{name: "json object split after the first line", sample: "{\"data\": [\n  {\"id\": 1}\n]}\n", expected: "json"},
+		{name: "comma separated", sample: "id,name\n1,\"Smith; John\"\n", expected: "csv", expectedComma: ','},
+		{name: "tab separated", sample: "id\tname\n1\tJohn, Smith\n", expected: "tsv", expectedComma: '\t'},
+		{name: "semicolon separated", sample: "id;amount\r\n1;3,50\r\n2;4,25\r\n", expected: "csv", expectedComma: ';'},
+		{name: "consistent delimiter wins", sample: "a,b|c\n1,2|3\n4|5,6,7\n", expected: "csv", expectedComma: '|'},
+		{name: "single column", sample: "id\n1\n2\n", expected: "csv", expectedComma: ','},
+		{name: "empty", sample: "", expected: "csv", expectedComma: ','},
+		{name: "yaml sequence", sample: "- host: web-1\n  port: 80\n", expected: "yaml"},
+		{name: "yaml documents", sample: "---\nhost: web-1\n", expected: "yaml"},
+		{name: "toml array of tables", sample: "[[hosts]]\nname = \"web-1\"\n", expected: "toml"},
+		{name: "json array of arrays", sample: "[[1, 2]]", expected: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := sniffFormat([]byte(tt.sample))
+			if format.Name != tt.expected {
+				t.Fatalf("Expected format %s, got %s", tt.expected, format.Name)
+			}
+			if tt.expectedComma == 0 {
+				return
+			}
+			if comma := sniffDelimiter([]byte(tt.sample)); comma != tt.expectedComma {
+				t.Errorf("Expected delimiter %q, got %q", tt.expectedComma, comma)
+			}
+		})
+	}
+}
+
+func TestResolveFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		format   string
+		expected string
+	}{
+		{name: "extension", file: "users.JSON", content: "id\n1\n", format: autoFormat, expected: "json"},
+		{name: "tsv extension", file: "users.tsv", content: "id\n1\n", format: autoFormat, expected: "tsv"},
+		{name: "explicit format wins over extension", file: "users.json", content: "[]", format: "jsonl", expected: "jsonl"},
+		{name: "unknown extension is sniffed", file: "export.txt", content: "{\"id\": 1}\n", format: autoFormat, expected: "jsonl"},
+		{name: "no extension is sniffed", file: "export", content: "[{\"id\": 1}]", format: autoFormat, expected: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataFile := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(dataFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write data file: %v", err)
+			}
+			in, err := openDataFile(dataFile, defaultEncoding)
+			if err != nil {
+				t.Fatalf("Failed to open data file: %v", err)
+			}
+			defer in.Close()
+
+			format, err := resolveFormat(in, tt.format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if format.Name != tt.expected {
+				t.Errorf("Expected format %s, got %s", tt.expected, format.Name)
+			}
+
+			// Sniffing must not consume the input
+			content, err := io.ReadAll(in.reader)
+			if err != nil || string(content) != tt.content {
+				t.Errorf("Expected the input to be unread, got %q, %v", string(content), err)
+			}
+		})
+	}
+
+	if _, err := resolveFormat(&dataInput{}, "parquet"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	semicolon := sniffFormat([]byte("a;b\n1;2\n"))
+	if format, ok := outputFormat("failed.txt", semicolon); !ok || format != semicolon {
+		t.Error("Expected a file without a registered extension to keep the data file's dialect")
+	}
+	if format, ok := outputFormat("failed.csv", semicolon); !ok || format.Name != "csv" || format.csv.comma != ';' {
+		t.Error("Expected a .csv file to keep the data file's delimiter")
+	}
+	if format, ok := outputFormat("failed.csv", formats["csv"]); !ok || format.csv.comma != ',' {
+		t.Error("Expected a .csv file to be written as standard CSV for standard CSV data")
+	}
+	if _, ok := outputFormat("failed.json", semicolon); ok {
+		t.Error("Expected a .json file to be rejected for CSV data")
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	format, err := lookupFormat("JSONL")
+	if err != nil || format.Name != "jsonl" {
+		t.Errorf("Expected jsonl format, got %v, %v", format, err)
+	}
+	if _, err := lookupFormat("parquet"); err == nil || !strings.Contains(err.Error(), "csv, json, jsonl, toml, tsv, xlsx, yaml") {
+		t.Errorf("Expected error listing the known formats, got %v", err)
+	}
+}
+
+func readAllRows(t *testing.T, format *Format, content string) ([]Row, error) {
+	t.Helper()
+	source, err := format.Open(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestRowSources(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		content     string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "csv keeps field order",
+			format:   "csv",
+			content:  "b,a\n1,2\n3,4\n",
+			expected: []string{"1 [b a] map[a:2 b:1]", "2 [b a] map[a:4 b:3]"},
+		},
+		{
+			name:     "json elements that are not objects are skipped",
+			format:   "json",
+			content:  `[{"id": 1}, 7, null, {"id": [2]}]`,
+			expected: []string{"1 [] map[id:1]", "2 error", "3 error", "4 [] map[id:[2]]"},
+		},
+		{
+			name:        "json syntax errors stop the source",
+			format:      "json",
+			content:     `[{"id": 1}, {"id" 2}]`,
+			expected:    []string{"1 [] map[id:1]"},
+			expectError: true,
+		},
+		{
+			name:     "jsonl skips blank lines and keeps going after bad lines",
+			format:   "jsonl",
+			content:  "{\"id\": 1}\n\nnot json\n{\"id\": 2}\n",
+			expected: []string{"1 [] map[id:1]", "2 error", "3 [] map[id:2]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readAllRows(t, formats[tt.format], tt.content)
+			if tt.expectError != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+
+			var got []string
+			for _, row := range rows {
+				if row.Err != nil {
+					got = append(got, fmt.Sprintf("%d error", row.Index))
+					continue
+				}
+				got = append(got, fmt.Sprintf("%d %v %v", row.Index, row.Fields, row.Values))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// lineSource is a minimal format reading one row per line, to check that a
+// format only needs to be described once to work with every feature
+type lineSource struct {
+	scanner *bufio.Scanner
+	index   int
+}
+
+func (s *lineSource) Next() (Row, error) {
+	if !s.scanner.Scan() {
+		return Row{}, io.EOF
+	}
+	s.index++
+	return Row{Index: s.index, Fields: []string{"line"}, Values: map[string]any{"line": s.scanner.Text()}}, nil
+}
+
+func TestProcessFileWithCustomFormat(t *testing.T) {
+	lines := &Format{
+		Name: "lines",
+		Open: func(r io.Reader) (RowSource, error) {
+			return &lineSource{scanner: bufio.NewScanner(r)}, nil
+		},
+		Count: func(r io.Reader) (int, error) {
+			n := 0
+			for scanner := bufio.NewScanner(r); scanner.Scan(); n++ {
+			}
+			return n, nil
+		},
+		NewEncoder: formats["csv"].NewEncoder,
+	}
+
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "hosts.txt")
+	if err := os.WriteFile(dataFile, []byte("alpha\nbeta\ngamma\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	var commands []string
+	r := newRunner(func(command string, progress Progress) error {
+		commands = append(commands, fmt.Sprintf("%s %s", progress, command))
+		if strings.Contains(command, "beta") {
+			return fmt.Errorf("unreachable")
+		}
+		return nil
+	}, 1)
+	failedFile := filepath.Join(dir, "failed.csv")
+	r.failedRows = newFailedRowsWriter(failedFile, lines)
+	if err := processFile(dataFile, lines, "ping {{.line}}", r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.failedRows.Close(rerunManifest{}); err != nil {
+		t.Fatalf("Failed to close failed rows file: %v", err)
+	}
+
+	expected := "[1/3] ping alpha|[2/3] ping beta|[3/3] ping gamma"
+	if strings.Join(commands, "|") != expected {
+		t.Errorf("Expected %q, got %q", expected, strings.Join(commands, "|"))
+	}
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "line\nbeta\n" {
+		t.Errorf("Expected the failed row, got %q", string(content))
+	}
+}
+
+func TestProcessDataFileDetectsFormat(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "export")
+	if err := os.WriteFile(dataFile, []byte("id;name\n1;Anna\n2;Ben\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	var commands []string
+	err := processDataFileWithExecutor(dataFile, "echo {{.id}}-{{.name}}", func(command string, progress Progress) error {
+		commands = append(commands, command)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(commands, "|") != "echo 1-Anna|echo 2-Ben" {
+		t.Errorf("Unexpected commands: %v", commands)
+	}
+}
+
+func TestProcessDataFileFormatRecordedForRerun(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "events.log")
+	if err := os.WriteFile(dataFile, []byte("{\"code\": 0}\n{\"code\": 3}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	failedFile := filepath.Join(dir, "failed.log")
+	config := Config{
+		DataFile:       dataFile,
+		Format:         "jsonl",
+		Template:       "exit {{.code}}",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		FailedRowsFile: failedFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if string(content) != "{\"code\":3}\n" {
+		t.Errorf("Expected the failed row as JSON Lines, got %q", string(content))
+	}
+	manifest, err := readRerunManifest(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest.Format != "jsonl" {
+		t.Errorf("Expected format jsonl in manifest, got %q", manifest.Format)
+	}
+}
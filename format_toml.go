@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func init() {
+	registerFormat(newTOMLFormat(nil))
+}
+
+// newTOMLFormat returns the toml format reading the array of tables at root
+func newTOMLFormat(root rowPath) *Format {
+	return &Format{
+		Name:       "toml",
+		Extensions: []string{".toml"},
+		Open: func(r io.Reader) (RowSource, error) {
+			return openTOML(r, root)
+		},
+		Count: func(r io.Reader) (int, error) {
+			return countTOMLRows(r, root)
+		},
+		NewEncoder: newTOMLEncoder,
+		root:       newTOMLFormat,
+	}
+}
+
+// tomlRowsKey is the array of tables failed rows and annotate files are
+// written to
+const tomlRowsKey = "rows"
+
+// tomlSource reads the tables of the document's array of tables, such as
+// every [[hosts]] table, or of the array of tables at a root
+type tomlSource struct {
+	tables []map[string]any
+	// fields are the keys of the tables in the order they first appear
+	fields []string
+	index  int
+}
+
+func openTOML(r io.Reader, root rowPath) (RowSource, error) {
+	var document map[string]any
+	meta, err := toml.NewDecoder(r).Decode(&document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TOML: %v", err)
+	}
+	key, tables, err := tomlTables(document, root)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &tomlSource{tables: tables}
+	seen := make(map[string]bool)
+	for _, k := range meta.Keys() {
+		if len(k) == len(key)+1 && slices.Equal(k[:len(key)], key) && !seen[k[len(key)]] {
+			seen[k[len(key)]] = true
+			source.fields = append(source.fields, k[len(key)])
+		}
+	}
+	return source, nil
+}
+
+// tomlTables returns the array of tables at root, or the document's only
+// array of tables without a root, with the key of its tables if it has one
+func tomlTables(document map[string]any, root rowPath) ([]string, []map[string]any, error) {
+	if len(root) > 0 {
+		key, _ := root.keys()
+		value, ok := tomlLookup(document, root)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s not found in the TOML document", root)
+		}
+		switch value := value.(type) {
+		case []map[string]any:
+			return key, value, nil
+		case map[string]any:
+			return nil, []map[string]any{value}, nil
+		case []any:
+			if tables, ok := tableList(value); ok || len(value) == 0 {
+				return key, tables, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("expected a TOML array of tables at %s", root)
+	}
+
+	var keys []string
+	var tables []map[string]any
+	for key, value := range document {
+		switch value := value.(type) {
+		case []map[string]any:
+			keys, tables = append(keys, key), value
+		case []any:
+			if list, ok := tableList(value); ok {
+				keys, tables = append(keys, key), list
+			}
+		}
+	}
+
+	switch len(keys) {
+	case 0:
+		return nil, nil, fmt.Errorf("expected a TOML array of tables such as [[hosts]]")
+	case 1:
+		return keys, tables, nil
+	}
+	sort.Strings(keys)
+	return nil, nil, fmt.Errorf("expected a single TOML array of tables, got %s (choose one with --root)", strings.Join(keys, ", "))
+}
+
+// tomlLookup follows path through a decoded TOML document
+func tomlLookup(document map[string]any, path rowPath) (any, bool) {
+	var v any = document
+	for _, step := range path {
+		switch value := v.(type) {
+		case map[string]any:
+			if step.isIndex {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = value[step.key]; !ok {
+				return nil, false
+			}
+		case []map[string]any:
+			if !step.isIndex || step.index >= len(value) {
+				return nil, false
+			}
+			v = value[step.index]
+		case []any:
+			if !step.isIndex || step.index >= len(value) {
+				return nil, false
+			}
+			v = value[step.index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// tableList returns list as tables if all of its elements are inline tables
+func tableList(list []any) ([]map[string]any, bool) {
+	tables := make([]map[string]any, 0, len(list))
+	for _, element := range list {
+		table, ok := element.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		tables = append(tables, table)
+	}
+	return tables, len(tables) > 0
+}
+
+func (s *tomlSource) Next() (Row, error) {
+	if s.index >= len(s.tables) {
+		return Row{}, io.EOF
+	}
+	table := s.tables[s.index]
+	s.index++
+
+	values := make(map[string]any, len(table))
+	var fields []string
+	for _, field := range s.fields {
+		if _, ok := table[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	var rest []string
+	for key, value := range table {
+		values[key] = tomlValue(value)
+		if !slices.Contains(s.fields, key) {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return Row{Index: s.index, Fields: append(fields, rest...), Values: values}, nil
+}
+
+// countTOMLRows counts the tables tomlSource reads from r
+func countTOMLRows(r io.Reader, root rowPath) (int, error) {
+	var document map[string]any
+	if _, err := toml.NewDecoder(r).Decode(&document); err != nil {
+		return 0, err
+	}
+	_, tables, err := tomlTables(document, root)
+	return len(tables), err
+}
+
+// tomlValue converts v to the types JSON values decode to, writing dates and
+// times as they appear in TOML
+func tomlValue(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		// The decoder marks local dates and times by their location
+		switch v.Location().String() {
+		case "date-local":
+			return v.Format("2006-01-02")
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	case map[string]any:
+		values := make(map[string]any, len(v))
+		for key, value := range v {
+			values[key] = tomlValue(value)
+		}
+		return values
+	case []map[string]any:
+		list := make([]any, len(v))
+		for i, value := range v {
+			list[i] = tomlValue(value)
+		}
+		return list
+	case []any:
+		list := make([]any, len(v))
+		for i, value := range v {
+			list[i] = tomlValue(value)
+		}
+		return list
+	}
+	return v
+}
+
+// tomlEncoder writes rows as the tables of a [[rows]] array. TOML nests
+// tables by name, so the document is written once all rows are known.
+type tomlEncoder struct {
+	w    io.Writer
+	rows []map[string]any
+}
+
+func newTOMLEncoder(w io.Writer) rowEncoder {
+	return &tomlEncoder{w: w}
+}
+
+func (e *tomlEncoder) Encode(row Row) error {
+	e.rows = append(e.rows, withoutNulls(row.Values).(map[string]any))
+	return nil
+}
+
+func (e *tomlEncoder) Close() error {
+	return toml.NewEncoder(e.w).Encode(map[string]any{tomlRowsKey: e.rows})
+}
+
+// withoutNulls returns v without null values, which TOML cannot represent
+func withoutNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		values := make(map[string]any, len(v))
+		for key, value := range v {
+			if value != nil {
+				values[key] = withoutNulls(value)
+			}
+		}
+		return values
+	case []any:
+		list := make([]any, 0, len(v))
+		for _, value := range v {
+			if value != nil {
+				list = append(list, withoutNulls(value))
+			}
+		}
+		return list
+	}
+	return v
+}
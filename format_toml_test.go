@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTOMLSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name: "array of tables",
+			content: `title = "inventory"
+
+[[hosts]]
+name = "web-1"
+port = 8080
+started = 2024-01-31
+backup = 03:30:00
+checked = 2024-01-31T10:00:00Z
+
+[hosts.owner]
+team = "ops"
+
+[[hosts]]
+name = "web-2"
+tags = ["a", "b"]
+`,
+			expected: []string{
+				"1 [name port started backup checked owner] map[backup:03:30:00 checked:2024-01-31T10:00:00Z name:web-1 owner:map[team:ops] port:8080 started:2024-01-31]",
+				"2 [name tags] map[name:web-2 tags:[a b]]",
+			},
+		},
+		{
+			name:     "array of inline tables",
+			content:  `hosts = [{name = "web-1"}, {name = "web-2"}]`,
+			expected: []string{"1 [name] map[name:web-1]", "2 [name] map[name:web-2]"},
+		},
+		{
+			name:        "no array of tables",
+			content:     "name = \"web-1\"\n",
+			expectError: true,
+		},
+		{
+			name:        "several arrays of tables",
+			content:     "[[hosts]]\nname = \"a\"\n[[services]]\nname = \"b\"\n",
+			expectError: true,
+		},
+		{
+			name:        "syntax error",
+			content:     "[[hosts]\nname = \"a\"\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readAllRows(t, formats["toml"], tt.content)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, row := range rows {
+				got = append(got, fmt.Sprintf("%d %v %v", row.Index, row.Fields, row.Values))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows\n%q\ngot\n%q", tt.expected, got)
+			}
+
+			count, err := countTOMLRows(strings.NewReader(tt.content), nil)
+			if err != nil {
+				t.Fatalf("Failed to count rows: %v", err)
+			}
+			if count != len(tt.expected) {
+				t.Errorf("Expected %d rows to be counted, got %d", len(tt.expected), count)
+			}
+		})
+	}
+}
+
+func TestTOMLEncoderRoundTrip(t *testing.T) {
+	rows := []Row{
+		{Values: map[string]any{"name": "web-1", "owner": map[string]any{"team": "ops"}, "exit_code": nil}},
+		{Values: map[string]any{"name": "web-2", "port": int64(8081)}},
+	}
+
+	var buf bytes.Buffer
+	encoder := newTOMLEncoder(&buf)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			t.Fatalf("Failed to encode row: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close encoder: %v", err)
+	}
+
+	written, err := readAllRows(t, formats["toml"], buf.String())
+	if err != nil {
+		t.Fatalf("Failed to read the written rows: %v\n%s", err, buf.String())
+	}
+	var got []string
+	for _, row := range written {
+		got = append(got, fmt.Sprint(row.Values))
+	}
+	expected := []string{"map[name:web-1 owner:map[team:ops]]", "map[name:web-2 port:8081]"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected rows %q, got %q", expected, got)
+	}
+}
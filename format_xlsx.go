@@ -0,0 +1,736 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerFormat(newXLSXFormat(xlsxOptions{}))
+}
+
+// xlsxOptions selects the cells of a workbook that are read as rows
+type xlsxOptions struct {
+	// sheet is the name or 1-based position of the worksheet to read, or
+	// empty for the first one
+	sheet string
+	// headerRow is the 1-based row holding the column names, or 0 for the
+	// first row of cells
+	headerRow int
+	// cells limits the cells that are read
+	cells cellRange
+}
+
+// isZero reports whether o reads the whole first worksheet
+func (o xlsxOptions) isZero() bool {
+	return o.sheet == "" && o.headerRow == 0 && o.cells == cellRange{}
+}
+
+// applyXLSXOptions returns format adjusted by options. Only spreadsheet
+// formats can be adjusted.
+func applyXLSXOptions(format *Format, options xlsxOptions) (*Format, error) {
+	if options.isZero() {
+		return format, nil
+	}
+	if format.xlsx == nil {
+		return nil, fmt.Errorf("spreadsheet options cannot be used with %s data", format.Name)
+	}
+	if options.headerRow != 0 && !options.cells.containsRow(options.headerRow) {
+		return nil, fmt.Errorf("header row %d is outside the range %s", options.headerRow, options.cells)
+	}
+	return newXLSXFormat(options), nil
+}
+
+func newXLSXFormat(options xlsxOptions) *Format {
+	return &Format{
+		Name:       "xlsx",
+		Extensions: []string{".xlsx", ".xlsm"},
+		xlsx:       &options,
+		Open: func(r io.Reader) (RowSource, error) {
+			return openXLSX(r, options)
+		},
+		Count: func(r io.Reader) (int, error) {
+			return countXLSXRows(r, options)
+		},
+		NewEncoder: newXLSXEncoder,
+	}
+}
+
+// cellRange is a rectangle of cells such as A1:D100. Zero bounds are open,
+// so B:D selects whole columns.
+type cellRange struct {
+	minCol, minRow int
+	maxCol, maxRow int
+}
+
+// parseCellRange parses a range such as A1:D100, B2:F or B:F
+func parseCellRange(s string) (cellRange, error) {
+	start, end, ok := strings.Cut(strings.ToUpper(strings.TrimSpace(s)), ":")
+	if !ok {
+		end = start
+	}
+	var r cellRange
+	var err error
+	if r.minCol, r.minRow, err = parseCellRef(start); err == nil {
+		r.maxCol, r.maxRow, err = parseCellRef(end)
+	}
+	if err != nil || (r.maxCol > 0 && r.maxCol < r.minCol) || (r.maxRow > 0 && r.maxRow < r.minRow) {
+		return cellRange{}, fmt.Errorf("invalid cell range %q (expected e.g. A1:D100)", s)
+	}
+	return r, nil
+}
+
+// parseCellRef parses a cell reference such as B12 into its 1-based column
+// and row. Either part may be left out, leaving it 0.
+func parseCellRef(ref string) (col, row int, err error) {
+	i := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		col = col*26 + int(ref[i]-'A'+1)
+		i++
+	}
+	if i < len(ref) {
+		if row, err = strconv.Atoi(ref[i:]); err != nil || row < 1 {
+			return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+		}
+	}
+	if i == 0 && row == 0 {
+		return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col, row, nil
+}
+
+// columnName returns the letters naming the 1-based column col
+func columnName(col int) string {
+	var name []byte
+	for ; col > 0; col = (col - 1) / 26 {
+		name = append([]byte{byte('A' + (col-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+func (r cellRange) containsRow(row int) bool {
+	return row >= r.minRow && (r.maxRow == 0 || row <= r.maxRow)
+}
+
+func (r cellRange) containsCol(col int) bool {
+	return col >= r.minCol && (r.maxCol == 0 || col <= r.maxCol)
+}
+
+func (r cellRange) String() string {
+	ref := func(col, row int) string {
+		s := columnName(col)
+		if row > 0 {
+			s += strconv.Itoa(row)
+		}
+		return s
+	}
+	return ref(r.minCol, r.minRow) + ":" + ref(r.maxCol, r.maxRow)
+}
+
+// dateKind says whether a number format shows a number as a date, a time
+// of day or both
+type dateKind int
+
+const (
+	notDate dateKind = iota
+	dateOnly
+	timeOnly
+	dateAndTime
+)
+
+// xlsxWorkbook holds the parts of a workbook needed to read its worksheets
+type xlsxWorkbook struct {
+	files    map[string]*zip.File
+	sheets   []xlsxSheet
+	strings  []string
+	styles   []dateKind
+	date1904 bool
+}
+
+type xlsxSheet struct {
+	name string
+	path string
+}
+
+type xlsxWorkbookPart struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name  string     `xml:"name,attr"`
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a string made of a plain part and formatted runs. Phonetic
+// runs are not part of the text.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxRow struct {
+	R     int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+type xlsxCell struct {
+	R      string    `xml:"r,attr"`
+	T      string    `xml:"t,attr"`
+	S      int       `xml:"s,attr"`
+	V      string    `xml:"v"`
+	Inline *xlsxText `xml:"is"`
+}
+
+// readXLSXWorkbook reads the workbook, shared strings and styles of the
+// .xlsx file in data
+func readXLSXWorkbook(data []byte) (*xlsxWorkbook, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file: %v", err)
+	}
+	wb := &xlsxWorkbook{files: make(map[string]*zip.File)}
+	for _, file := range archive.File {
+		wb.files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	var workbook xlsxWorkbookPart
+	if err := wb.decodePart("xl/workbook.xml", &workbook, true); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := wb.decodePart("xl/_rels/workbook.xml.rels", &rels, true); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+
+	wb.date1904 = workbook.Properties.Date1904
+	for _, sheet := range workbook.Sheets {
+		for _, attr := range sheet.Attrs {
+			// The relationship id is namespaced differently in strict workbooks
+			if attr.Name.Local == "id" {
+				wb.sheets = append(wb.sheets, xlsxSheet{name: sheet.Name, path: targets[attr.Value]})
+			}
+		}
+	}
+
+	var sst xlsxSharedStrings
+	if err := wb.decodePart("xl/sharedStrings.xml", &sst, false); err != nil {
+		return nil, err
+	}
+	for _, item := range sst.Items {
+		wb.strings = append(wb.strings, item.String())
+	}
+
+	var styles xlsxStyles
+	if err := wb.decodePart("xl/styles.xml", &styles, false); err != nil {
+		return nil, err
+	}
+	codes := make(map[int]string)
+	for _, numFmt := range styles.NumFmts {
+		codes[numFmt.ID] = numFmt.Code
+	}
+	for _, xf := range styles.CellXfs {
+		kind := builtinDateKind(xf.NumFmtID)
+		if code, ok := codes[xf.NumFmtID]; ok {
+			kind = formatCodeDateKind(code)
+		}
+		wb.styles = append(wb.styles, kind)
+	}
+	return wb, nil
+}
+
+// decodePart decodes the XML part called name into v. A missing part is an
+// error only if it is required.
+func (wb *xlsxWorkbook) decodePart(name string, v any, required bool) error {
+	file, ok := wb.files[name]
+	if !ok {
+		if required {
+			return fmt.Errorf("failed to read XLSX file: %s is missing", name)
+		}
+		return nil
+	}
+	part, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read XLSX file: %v", err)
+	}
+	defer part.Close()
+	if err := xml.NewDecoder(part).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	return nil
+}
+
+// sheet returns the worksheet called name, or at the 1-based position name,
+// or the first worksheet when name is empty
+func (wb *xlsxWorkbook) sheet(name string) (xlsxSheet, error) {
+	if len(wb.sheets) == 0 {
+		return xlsxSheet{}, fmt.Errorf("the workbook has no worksheets")
+	}
+	if name == "" {
+		return wb.sheets[0], nil
+	}
+	var names []string
+	for _, sheet := range wb.sheets {
+		if sheet.name == name {
+			return sheet, nil
+		}
+		names = append(names, strconv.Quote(sheet.name))
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 1 && i <= len(wb.sheets) {
+		return wb.sheets[i-1], nil
+	}
+	return xlsxSheet{}, fmt.Errorf("sheet %q not found (the workbook has %s)", name, strings.Join(names, ", "))
+}
+
+// cellValue returns the text of c as seen by templates: numbers without
+// floating point noise, dates as 2006-01-02 15:04:05 and booleans as
+// true/false
+func (wb *xlsxWorkbook) cellValue(c xlsxCell) string {
+	switch c.T {
+	case "s":
+		i, err := strconv.Atoi(c.V)
+		if err != nil || i < 0 || i >= len(wb.strings) {
+			return ""
+		}
+		return wb.strings[i]
+	case "inlineStr":
+		if c.Inline == nil {
+			return ""
+		}
+		return c.Inline.String()
+	case "b":
+		return strconv.FormatBool(c.V == "1")
+	case "str", "e", "d":
+		return c.V
+	}
+
+	if c.V == "" {
+		return ""
+	}
+	number, err := strconv.ParseFloat(c.V, 64)
+	if err != nil {
+		return c.V
+	}
+	if c.S >= 0 && c.S < len(wb.styles) && wb.styles[c.S] != notDate {
+		return formatExcelDate(number, wb.date1904, wb.styles[c.S])
+	}
+	return formatExcelNumber(number)
+}
+
+// formatExcelNumber formats number with the 15 significant digits Excel
+// keeps, hiding floating point noise such as 0.30000000000000004
+func formatExcelNumber(number float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(number, 'g', 15, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// formatExcelDate formats the Excel serial date number, counted in days
+// since the start of the workbook's date system
+func formatExcelDate(serial float64, date1904 bool, kind dateKind) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial < 60 {
+		// Excel counts the non-existent 29 February 1900
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 24 * 60 * 60)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	switch kind {
+	case dateOnly:
+		return t.Format("2006-01-02")
+	case timeOnly:
+		return t.Format("15:04:05")
+	default:
+		return t.Format("2006-01-02 15:04:05")
+	}
+}
+
+// builtinDateKind classifies the number formats built into Excel, which
+// workbooks refer to by id without spelling them out
+func builtinDateKind(id int) dateKind {
+	switch {
+	case id >= 14 && id <= 17, id >= 27 && id <= 31, id == 36, id >= 50 && id <= 58:
+		return dateOnly
+	case id >= 18 && id <= 21, id >= 32 && id <= 35, id >= 45 && id <= 47:
+		return timeOnly
+	case id == 22:
+		return dateAndTime
+	}
+	return notDate
+}
+
+// formatCodeDateKind classifies a custom number format such as yyyy-mm-dd
+// by the date and time tokens in its first section, skipping quoted text,
+// escaped characters, and colours and locales in brackets
+func formatCodeDateKind(code string) dateKind {
+	var date, clock, month bool
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; c {
+		case ';':
+			i = len(code)
+		case '"':
+			if end := strings.IndexByte(code[i+1:], '"'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(code)
+			}
+		case '\\', '_', '*':
+			i++
+		case '[':
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				i = len(code)
+				break
+			}
+			// Elapsed time such as [h] or [mm]
+			if inner := strings.ToLower(code[i+1 : i+end]); inner != "" && strings.Trim(inner, "hms") == "" {
+				clock = true
+			}
+			i += end
+		case 'y', 'Y', 'd', 'D':
+			date = true
+		case 'h', 'H', 's', 'S':
+			clock = true
+		case 'm', 'M':
+			month = true
+		}
+	}
+
+	switch {
+	case date && clock:
+		return dateAndTime
+	case date || (month && !clock):
+		return dateOnly
+	case clock:
+		return timeOnly
+	}
+	return notDate
+}
+
+// xlsxSource reads the rows of a worksheet below its header row, one
+// <row> element at a time. Rows without any values are skipped.
+type xlsxSource struct {
+	wb      *xlsxWorkbook
+	part    io.ReadCloser
+	decoder *xml.Decoder
+	options xlsxOptions
+	// columns are the 1-based columns read, named by headers
+	columns []int
+	headers []string
+	index   int
+}
+
+func openXLSX(r io.Reader, options xlsxOptions) (RowSource, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file: %v", err)
+	}
+	wb, err := readXLSXWorkbook(data)
+	if err != nil {
+		return nil, err
+	}
+	sheet, err := wb.sheet(options.sheet)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := wb.files[sheet.path]
+	if !ok {
+		return nil, fmt.Errorf("failed to read XLSX file: worksheet %s is missing", sheet.path)
+	}
+	part, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file: %v", err)
+	}
+
+	source := &xlsxSource{wb: wb, part: part, decoder: xml.NewDecoder(part), options: options}
+	if err := source.readHeaders(sheet.name); err != nil {
+		part.Close()
+		return nil, err
+	}
+	return source, nil
+}
+
+// readHeaders reads the header row, naming the columns up to the last
+// header (or the end of the range) after their header cells, or after their
+// column letters when those are empty
+func (s *xlsxSource) readHeaders(sheetName string) error {
+	for {
+		row, err := s.nextRow()
+		if err == io.EOF {
+			return fmt.Errorf("failed to read XLSX headers: sheet %q has no header row", sheetName)
+		}
+		if err != nil {
+			return err
+		}
+		if s.options.headerRow != 0 && row.R < s.options.headerRow {
+			continue
+		}
+		if s.options.headerRow != 0 && row.R > s.options.headerRow {
+			return fmt.Errorf("failed to read XLSX headers: sheet %q has no row %d", sheetName, s.options.headerRow)
+		}
+
+		values := s.values(row)
+		if s.options.headerRow == 0 && len(values) == 0 {
+			// Leading empty rows are not the header
+			continue
+		}
+		s.options.headerRow = row.R
+
+		first, last := max(s.options.cells.minCol, 1), s.options.cells.maxCol
+		if last == 0 {
+			for col := range values {
+				last = max(last, col)
+			}
+		}
+		for col := first; col <= last; col++ {
+			name := strings.TrimSpace(values[col])
+			if name == "" {
+				name = columnName(col)
+			}
+			s.columns = append(s.columns, col)
+			s.headers = append(s.headers, name)
+		}
+		return nil
+	}
+}
+
+// nextRow returns the next <row> of the worksheet within the range, filling
+// in row numbers that are left out
+func (s *xlsxSource) nextRow() (xlsxRow, error) {
+	last := 0
+	for {
+		token, err := s.decoder.Token()
+		if err == io.EOF {
+			return xlsxRow{}, io.EOF
+		}
+		if err != nil {
+			return xlsxRow{}, fmt.Errorf("failed to parse worksheet: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err := s.decoder.DecodeElement(&row, &start); err != nil {
+			return xlsxRow{}, fmt.Errorf("failed to parse worksheet: %v", err)
+		}
+		if row.R == 0 {
+			row.R = last + 1
+		}
+		last = row.R
+		if s.options.cells.maxRow != 0 && row.R > s.options.cells.maxRow {
+			return xlsxRow{}, io.EOF
+		}
+		if s.options.cells.containsRow(row.R) {
+			return row, nil
+		}
+	}
+}
+
+// values returns the non-empty values of row within the range by column
+func (s *xlsxSource) values(row xlsxRow) map[int]string {
+	values := make(map[int]string)
+	col := 0
+	for _, cell := range row.Cells {
+		col++
+		if cell.R != "" {
+			if c, _, err := parseCellRef(cell.R); err == nil && c > 0 {
+				col = c
+			}
+		}
+		if !s.options.cells.containsCol(col) {
+			continue
+		}
+		if value := s.wb.cellValue(cell); value != "" {
+			values[col] = value
+		}
+	}
+	return values
+}
+
+func (s *xlsxSource) Next() (Row, error) {
+	for {
+		row, err := s.nextRow()
+		if err != nil {
+			if err == io.EOF {
+				s.part.Close()
+			}
+			return Row{}, err
+		}
+
+		values := s.values(row)
+		rowValues := make(map[string]any, len(s.headers))
+		for i, col := range s.columns {
+			rowValues[s.headers[i]] = values[col]
+		}
+		empty := true
+		for _, col := range s.columns {
+			if values[col] != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+
+		s.index++
+		return Row{Index: s.index, Fields: s.headers, Values: rowValues}, nil
+	}
+}
+
+// countXLSXRows counts the rows openXLSX reads from r
+func countXLSXRows(r io.Reader, options xlsxOptions) (int, error) {
+	source, err := openXLSX(r, options)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		if _, err := source.Next(); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+// xlsxEncoder writes rows as a workbook with a single worksheet, with the
+// first row's fields as the header row. Rows are held until Close, since the
+// workbook is a zip archive.
+type xlsxEncoder struct {
+	w      io.Writer
+	fields []string
+	rows   [][]string
+}
+
+func newXLSXEncoder(w io.Writer) rowEncoder {
+	return &xlsxEncoder{w: w}
+}
+
+func (e *xlsxEncoder) Encode(row Row) error {
+	if e.fields == nil {
+		e.fields = row.Fields
+		e.rows = append(e.rows, e.fields)
+	}
+
+	values := stringValues(row.Values)
+	record := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		record[i] = values[field]
+	}
+	e.rows = append(e.rows, record)
+	return nil
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+func (e *xlsxEncoder) Close() error {
+	archive := zip.NewWriter(e.w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxPackageRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		w, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+
+	w, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, record := range e.rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, value := range record {
+			if value == "" {
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(j+1), i+1)
+			xml.EscapeText(&sheet, []byte(value))
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	if _, err := w.Write(sheet.Bytes()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildXLSX returns a workbook with the given worksheets, each given as the
+// contents of its <sheetData> element, and the shared strings
+func buildXLSX(t *testing.T, date1904 bool, sharedStrings []string, sheets ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	write := func(name, content string) {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		w.Write([]byte(content))
+	}
+
+	var sheetList, rels strings.Builder
+	for i, sheet := range sheets {
+		fmt.Fprintf(&sheetList, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, sheet[0], i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		write(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1),
+			`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`+sheet[1]+`</sheetData></worksheet>`)
+	}
+	write("xl/workbook.xml", fmt.Sprintf(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<workbookPr date1904="%t"/><sheets>%s</sheets></workbook>`, date1904, sheetList.String()))
+	write("xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+rels.String()+`</Relationships>`)
+
+	var sst strings.Builder
+	for _, s := range sharedStrings {
+		fmt.Fprintf(&sst, "<si><t>%s</t></si>", s)
+	}
+	// A rich text string made of runs, with a phonetic reading that is not part of the text
+	sst.WriteString(`<si><r><t>Yama</t></r><r><t>da</t></r><rPh><t>やまだ</t></rPh></si>`)
+	write("xl/sharedStrings.xml", "<sst>"+sst.String()+"</sst>")
+
+	// Styles: 0 general, 1 built-in date, 2 custom date and time, 3 built-in time, 4 percent
+	write("xl/styles.xml", `<styleSheet><numFmts><numFmt numFmtId="164" formatCode="yyyy/mm/dd\ hh:mm;@"/></numFmts>`+
+		`<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="20"/><xf numFmtId="10"/></cellXfs></styleSheet>`)
+
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to write workbook: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const usersSheet = `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c></row>` +
+	`<row r="2"><c r="A2"><v>1</v></c><c r="B2" t="s"><v>4</v></c><c r="C2" s="1"><v>45322</v></c><c r="D2" s="4"><v>0.30000000000000004</v></c></row>` +
+	`<row r="4"><c r="A4"><v>2</v></c><c r="B4" t="inlineStr"><is><t>Ben &amp; Co</t></is></c><c r="C4" s="2"><v>45322.5</v></c><c r="D4" t="b"><v>1</v></c></row>` +
+	`<row r="5"><c r="B5" t="str"><v></v></c></row>` +
+	`<row r="6"><c r="A6"><v>3</v></c><c r="C6" s="3"><v>0.75</v></c><c r="D6" t="e"><v>#N/A</v></c></row>`
+
+func TestXLSXSource(t *testing.T) {
+	shared := []string{"id", "name", "joined", "score"}
+	workbook := buildXLSX(t, false, shared,
+		[2]string{"Users", usersSheet},
+		[2]string{"Report 2024", `<row r="1"><c r="A1" t="inlineStr"><is><t>generated</t></is></c></row>` +
+			`<row r="3"><c r="B3" t="inlineStr"><is><t>sku</t></is></c><c r="C3" t="inlineStr"><is><t>qty</t></is></c><c r="D3" t="inlineStr"><is><t>note</t></is></c></row>` +
+			`<row r="4"><c r="B4" t="inlineStr"><is><t>A-1</t></is></c><c r="C4"><v>12</v></c><c r="D4" t="inlineStr"><is><t>ignored</t></is></c></row>` +
+			`<row r="5"><c r="B5" t="inlineStr"><is><t>A-2</t></is></c><c r="C5"><v>1E-3</v></c></row>` +
+			`<row r="6"><c r="B6" t="inlineStr"><is><t>total</t></is></c></row>`},
+	)
+
+	tests := []struct {
+		name        string
+		options     xlsxOptions
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:    "first sheet with dates, numbers and booleans",
+			options: xlsxOptions{},
+			expected: []string{
+				"1 [id name joined score] map[id:1 joined:2024-01-31 name:Yamada score:0.3]",
+				"2 [id name joined score] map[id:2 joined:2024-01-31 12:00:00 name:Ben & Co score:true]",
+				"3 [id name joined score] map[id:3 joined:18:00:00 name: score:#N/A]",
+			},
+		},
+		{
+			name:    "sheet by name with a header row and range",
+			options: xlsxOptions{sheet: "Report 2024", headerRow: 3, cells: cellRange{minCol: 2, maxCol: 3, maxRow: 5}},
+			expected: []string{
+				"1 [sku qty] map[qty:12 sku:A-1]",
+				"2 [sku qty] map[qty:0.001 sku:A-2]",
+			},
+		},
+		{
+			name:    "sheet by position with the header at the start of the range",
+			options: xlsxOptions{sheet: "2", cells: cellRange{minCol: 2, minRow: 3, maxCol: 3}},
+			expected: []string{
+				"1 [sku qty] map[qty:12 sku:A-1]",
+				"2 [sku qty] map[qty:0.001 sku:A-2]",
+				"3 [sku qty] map[qty: sku:total]",
+			},
+		},
+		{
+			name:        "unknown sheet",
+			options:     xlsxOptions{sheet: "Orders"},
+			expectError: true,
+		},
+		{
+			name:        "missing header row",
+			options:     xlsxOptions{headerRow: 3},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := newXLSXFormat(tt.options)
+			rows, err := readAllRows(t, format, string(workbook))
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, row := range rows {
+				got = append(got, fmt.Sprintf("%d %v %v", row.Index, row.Fields, row.Values))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows\n%q\ngot\n%q", tt.expected, got)
+			}
+
+			count, err := format.Count(bytes.NewReader(workbook))
+			if err != nil {
+				t.Fatalf("Failed to count rows: %v", err)
+			}
+			if count != len(tt.expected) {
+				t.Errorf("Expected %d rows to be counted, got %d", len(tt.expected), count)
+			}
+		})
+	}
+}
+
+func TestXLSX1904DateSystem(t *testing.T) {
+	workbook := buildXLSX(t, true, []string{"day"},
+		[2]string{"Sheet1", `<row><c t="s"><v>0</v></c></row><row><c s="1"><v>0</v></c></row><row><c s="1"><v>43860</v></c></row>`})
+	rows, err := readAllRows(t, formats["xlsx"], string(workbook))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, row.Values["day"].(string))
+	}
+	if strings.Join(got, ",") != "1904-01-01,2024-01-31" {
+		t.Errorf("Expected dates in the 1904 date system, got %q", got)
+	}
+}
+
+func TestFormatExcelDate(t *testing.T) {
+	tests := []struct {
+		serial   float64
+		kind     dateKind
+		expected string
+	}{
+		{serial: 1, kind: dateOnly, expected: "1900-01-01"},
+		{serial: 59, kind: dateOnly, expected: "1900-02-28"},
+		{serial: 61, kind: dateOnly, expected: "1900-03-01"},
+		{serial: 45322.25, kind: dateAndTime, expected: "2024-01-31 06:00:00"},
+		{serial: 0.5000001, kind: timeOnly, expected: "12:00:00"},
+	}
+
+	for _, tt := range tests {
+		if got := formatExcelDate(tt.serial, false, tt.kind); got != tt.expected {
+			t.Errorf("formatExcelDate(%v) = %s, expected %s", tt.serial, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatCodeDateKind(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected dateKind
+	}{
+		{code: "yyyy-mm-dd", expected: dateOnly},
+		{code: "mmm", expected: dateOnly},
+		{code: "d/m/yyyy h:mm", expected: dateAndTime},
+		{code: "[h]:mm:ss", expected: timeOnly},
+		{code: "h:mm AM/PM", expected: timeOnly},
+		{code: "[$-409]dddd, mmmm dd, yyyy", expected: dateOnly},
+		{code: "0.00", expected: notDate},
+		{code: "#,##0 \"days\"", expected: notDate},
+		{code: "[Red]0.0;[Blue]-0.0", expected: notDate},
+		{code: "0\\d", expected: notDate},
+		{code: "@", expected: notDate},
+	}
+
+	for _, tt := range tests {
+		if got := formatCodeDateKind(tt.code); got != tt.expected {
+			t.Errorf("formatCodeDateKind(%q) = %d, expected %d", tt.code, got, tt.expected)
+		}
+	}
+}
+
+func TestParseCellRange(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    cellRange
+		expectError bool
+	}{
+		{input: "A1:D100", expected: cellRange{minCol: 1, minRow: 1, maxCol: 4, maxRow: 100}},
+		{input: "b2:f", expected: cellRange{minCol: 2, minRow: 2, maxCol: 6}},
+		{input: "B:AA", expected: cellRange{minCol: 2, maxCol: 27}},
+		{input: "C3", expected: cellRange{minCol: 3, minRow: 3, maxCol: 3, maxRow: 3}},
+		{input: "D1:A1", expectError: true},
+		{input: "A0:B2", expectError: true},
+		{input: "1:2:3", expectError: true},
+		{input: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseCellRange(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for %q", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestXLSXEncoderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := newXLSXEncoder(&buf)
+	rows := []Row{
+		{Fields: []string{"id", "note"}, Values: map[string]any{"id": "1", "note": "a < b & \"c\""}},
+		{Fields: []string{"id", "note"}, Values: map[string]any{"id": "2", "note": "line\nbreak"}},
+	}
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			t.Fatalf("Failed to encode row: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close encoder: %v", err)
+	}
+
+	got, err := readAllRows(t, formats["xlsx"], buf.String())
+	if err != nil {
+		t.Fatalf("Failed to read the written workbook: %v", err)
+	}
+	if len(got) != 2 || got[0].Values["note"] != "a < b & \"c\"" || got[1].Values["note"] != "line\nbreak" {
+		t.Errorf("Expected the rows to be read back, got %v", got)
+	}
+}
+
+func TestProcessDataFileWithXLSX(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "users.xlsx")
+	if err := os.WriteFile(dataFile, buildXLSX(t, false, []string{"id", "name", "joined", "score"}, [2]string{"Users", usersSheet}), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	failedFile := filepath.Join(dir, "failed.xlsx")
+	config := Config{
+		DataFile:       dataFile,
+		Format:         autoFormat,
+		Template:       "test {{.id}} != 2",
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		FailedRowsFile: failedFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(failedFile)
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	rows, err := readAllRows(t, formats["xlsx"], string(content))
+	if err != nil {
+		t.Fatalf("Failed to read failed rows file: %v", err)
+	}
+	if len(rows) != 1 || fmt.Sprint(rows[0].Values) != "map[id:2 joined:2024-01-31 12:00:00 name:Ben & Co score:true]" {
+		t.Errorf("Expected row 2 in the failed rows file, got %v", rows)
+	}
+
+	// Workbooks are also recognised without their extension
+	if format := sniffFormat(content); format.Name != "xlsx" {
+		t.Errorf("Expected the workbook to be detected as xlsx, got %s", format.Name)
+	}
+
+	config.Encoding = "latin-1"
+	if err := processDataFile(config); err == nil {
+		t.Errorf("Expected --encoding to be rejected for xlsx data")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	registerFormat(newYAMLFormat(nil))
+}
+
+// newYAMLFormat returns the yaml format reading the rows at root in each
+// document
+func newYAMLFormat(root rowPath) *Format {
+	return &Format{
+		Name:       "yaml",
+		Extensions: []string{".yaml", ".yml"},
+		Open: func(r io.Reader) (RowSource, error) {
+			return openYAML(r, root)
+		},
+		Count: func(r io.Reader) (int, error) {
+			return countYAMLRows(r, root)
+		},
+		NewEncoder: newYAMLEncoder,
+		root:       newYAMLFormat,
+	}
+}
+
+// yamlSource reads the rows of a YAML stream. A document holding a sequence
+// gives a row for each of its elements, and any other document is a row of
+// its own, so that both lists and multi-document streams can be read.
+type yamlSource struct {
+	decoder *yaml.Decoder
+	root    rowPath
+	pending []*yaml.Node
+	index   int
+}
+
+func openYAML(r io.Reader, root rowPath) (RowSource, error) {
+	return &yamlSource{decoder: yaml.NewDecoder(r), root: root}, nil
+}
+
+func (s *yamlSource) Next() (Row, error) {
+	for len(s.pending) == 0 {
+		document, err := nextYAMLDocument(s.decoder)
+		if err != nil {
+			return Row{}, err
+		}
+		nodes, err := yamlRows(document, s.root)
+		if err != nil {
+			s.index++
+			return Row{Index: s.index, Err: err}, nil
+		}
+		s.pending = nodes
+	}
+
+	node := s.pending[0]
+	s.pending = s.pending[1:]
+	s.index++
+	values, fields, err := yamlMapping(node)
+	if err != nil {
+		return Row{Index: s.index, Err: err}, nil
+	}
+	return Row{Index: s.index, Fields: fields, Values: values}, nil
+}
+
+// nextYAMLDocument returns the next document that is not empty or null
+func nextYAMLDocument(decoder *yaml.Decoder) (*yaml.Node, error) {
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %v", err)
+		}
+		if node := resolveYAML(&document); node != nil && node.ShortTag() != "!!null" {
+			return node, nil
+		}
+	}
+}
+
+// yamlRows returns the row nodes of a document, looked for at root: the
+// elements of a sequence, or any other node as a row of its own
+func yamlRows(document *yaml.Node, root rowPath) ([]*yaml.Node, error) {
+	node := document
+	for _, step := range root {
+		if node = yamlChild(node, step); node == nil {
+			return nil, fmt.Errorf("%s not found in the YAML document on line %d", root, document.Line)
+		}
+	}
+	switch {
+	case node.Kind == yaml.SequenceNode:
+		return node.Content, nil
+	case node.ShortTag() == "!!null":
+		return nil, nil
+	}
+	return []*yaml.Node{node}, nil
+}
+
+// yamlChild returns the value of node at step, or nil if it has none
+func yamlChild(node *yaml.Node, step pathStep) *yaml.Node {
+	node = resolveYAML(node)
+	switch {
+	case node == nil:
+		return nil
+	case step.isIndex:
+		if node.Kind == yaml.SequenceNode && step.index < len(node.Content) {
+			return resolveYAML(node.Content[step.index])
+		}
+	case node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if key := resolveYAML(node.Content[i]); key != nil && key.Kind == yaml.ScalarNode && key.Value == step.key {
+				return resolveYAML(node.Content[i+1])
+			}
+		}
+	}
+	return nil
+}
+
+// countYAMLRows counts the rows yamlSource reads from r
+func countYAMLRows(r io.Reader, root rowPath) (int, error) {
+	decoder := yaml.NewDecoder(r)
+	n := 0
+	for {
+		document, err := nextYAMLDocument(decoder)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if nodes, err := yamlRows(document, root); err != nil {
+			n++
+		} else {
+			n += len(nodes)
+		}
+	}
+}
+
+// resolveYAML returns the node a document or alias stands for
+func resolveYAML(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// yamlMapping converts a mapping node to the values of a row, with its keys
+// in document order. Keys merged in with << come after the mapping's own.
+func yamlMapping(node *yaml.Node) (map[string]any, []string, error) {
+	mapping := resolveYAML(node)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("expected a YAML mapping on line %d", node.Line)
+	}
+	node = mapping
+
+	values := make(map[string]any, len(node.Content)/2)
+	var fields []string
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.ShortTag() == "!!merge" {
+			if merged := resolveYAML(value); merged != nil && merged.Kind == yaml.SequenceNode {
+				merges = append(merges, merged.Content...)
+			} else {
+				merges = append(merges, value)
+			}
+			continue
+		}
+		if key = resolveYAML(key); key.Kind != yaml.ScalarNode {
+			return nil, nil, fmt.Errorf("unsupported YAML mapping key on line %d", key.Line)
+		}
+
+		name := key.Value
+		v, err := yamlValue(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[name]; !ok {
+			fields = append(fields, name)
+		}
+		values[name] = v
+	}
+
+	for _, merge := range merges {
+		mergedValues, mergedFields, err := yamlMapping(merge)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, name := range mergedFields {
+			if _, ok := values[name]; !ok {
+				fields = append(fields, name)
+				values[name] = mergedValues[name]
+			}
+		}
+	}
+	return values, fields, nil
+}
+
+// yamlValue converts node to the types JSON values decode to, keeping
+// timestamps as written
+func yamlValue(node *yaml.Node) (any, error) {
+	node = resolveYAML(node)
+	if node == nil {
+		return nil, nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		values, _, err := yamlMapping(node)
+		return values, err
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(node.Content))
+		for _, element := range node.Content {
+			v, err := yamlValue(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+
+	if node.ShortTag() == "!!timestamp" {
+		return node.Value, nil
+	}
+	var v any
+	if err := node.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML on line %d: %v", node.Line, err)
+	}
+	return v, nil
+}
+
+// yamlEncoder writes rows as the mappings of a YAML sequence, keeping the
+// order of the row's fields
+type yamlEncoder struct {
+	w io.Writer
+}
+
+func newYAMLEncoder(w io.Writer) rowEncoder {
+	return &yamlEncoder{w: w}
+}
+
+func (e *yamlEncoder) Encode(row Row) error {
+	fields := row.Fields
+	if fields == nil {
+		for field := range row.Values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range fields {
+		key := &yaml.Node{}
+		key.SetString(field)
+		value := &yaml.Node{}
+		if err := value.Encode(row.Values[field]); err != nil {
+			return err
+		}
+		mapping.Content = append(mapping.Content, key, value)
+	}
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(mapping); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(data.String(), "\n"), "\n") {
+		switch {
+		case i == 0:
+			b.WriteString("- " + line)
+		case line != "":
+			b.WriteString("  " + line)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *yamlEncoder) Close() error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYAMLSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name: "top-level sequence keeps key order and nested values",
+			content: `# inventory
+- host: web-1
+  port: 8080
+  tags: [a, b]
+  owner: {team: ops, oncall: true}
+- host: web-2
+  port: 8081
+  started: 2024-01-31
+  ratio: 0.5
+  note: null
+`,
+			expected: []string{
+				"1 [host port tags owner] map[host:web-1 owner:map[oncall:true team:ops] port:8080 tags:[a b]]",
+				"2 [host port started ratio note] map[host:web-2 note:<nil> port:8081 ratio:0.5 started:2024-01-31]",
+			},
+		},
+		{
+			name:     "multi-document stream",
+			content:  "---\nhost: web-1\n---\n---\nhost: web-2\n...\n",
+			expected: []string{"1 [host] map[host:web-1]", "2 [host] map[host:web-2]"},
+		},
+		{
+			name: "anchors and merge keys",
+			content: `- &defaults
+  region: eu
+  size: small
+- <<: *defaults
+  host: web-2
+  size: large
+`,
+			expected: []string{
+				"1 [region size] map[region:eu size:small]",
+				"2 [host size region] map[host:web-2 region:eu size:large]",
+			},
+		},
+		{
+			name:     "elements that are not mappings are reported",
+			content:  "- host: web-1\n- just a string\n- host: web-3\n",
+			expected: []string{"1 [host] map[host:web-1]", "2 error", "3 [host] map[host:web-3]"},
+		},
+		{
+			name:        "syntax errors stop the source",
+			content:     "- host: web-1\n- host: [unclosed\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readAllRows(t, formats["yaml"], tt.content)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, row := range rows {
+				if row.Err != nil {
+					got = append(got, fmt.Sprintf("%d error", row.Index))
+					continue
+				}
+				got = append(got, fmt.Sprintf("%d %v %v", row.Index, row.Fields, row.Values))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows\n%q\ngot\n%q", tt.expected, got)
+			}
+
+			count, err := countYAMLRows(strings.NewReader(tt.content), nil)
+			if err != nil {
+				t.Fatalf("Failed to count rows: %v", err)
+			}
+			if count != len(tt.expected) {
+				t.Errorf("Expected %d rows to be counted, got %d", len(tt.expected), count)
+			}
+		})
+	}
+}
+
+func TestYAMLEncoderRoundTrip(t *testing.T) {
+	rows, err := readAllRows(t, formats["yaml"], "- host: web-1\n  script: |\n    echo one\n\n    echo two\n  owner: {team: ops}\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rows = append(rows, Row{Values: map[string]any{"b": "2", "a": 1.5}})
+
+	var buf bytes.Buffer
+	encoder := newYAMLEncoder(&buf)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			t.Fatalf("Failed to encode row: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Failed to close encoder: %v", err)
+	}
+
+	expected := "- host: web-1\n  script: |\n    echo one\n\n    echo two\n  owner:\n    team: ops\n- a: 1.5\n  b: \"2\"\n"
+	if buf.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, buf.String())
+	}
+	written, err := readAllRows(t, formats["yaml"], buf.String())
+	if err != nil || len(written) != 2 || fmt.Sprint(written[0].Values) != fmt.Sprint(rows[0].Values) {
+		t.Errorf("Expected the rows to be read back, got %v, %v", written, err)
+	}
+}
+
+func TestProcessDataFileWithYAML(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "hosts.yml")
+	content := "- host: web-1\n  owner: {team: ops}\n- host: web-2\n  owner: {team: dev}\n"
+	if err := os.WriteFile(dataFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	var commands []string
+	err := processDataFileWithExecutor(dataFile, "deploy {{.host}} {{.owner}}", func(command string, progress Progress) error {
+		commands = append(commands, command)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{`deploy web-1 {"team":"ops"}`, `deploy web-2 {"team":"dev"}`}
+	if strings.Join(commands, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected commands %q, got %q", expected, commands)
+	}
+}
@@ -1,3 +1,9 @@
 module github.com/myuon/xrun
 
-go 1.24
\ No newline at end of file
+go 1.24.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	golang.org/x/text v0.34.0
+	gopkg.in/yaml.v3 v3.0.1
+)
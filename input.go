@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// stdinDataFile is the -d value reading the data from stdin
+const stdinDataFile = "-"
+
+// dataInput is where rows are read from: a data file, stdin or the output of
+// a --data-cmd command
+type dataInput struct {
+	// name describes the input, e.g. in log file names
+	name string
+	// path is the data file, or empty when the input can only be read once
+	path string
+	// encoding is the character encoding the input is converted from
+	encoding string
+	reader   *bufio.Reader
+	file     *os.File
+
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	release func()
+	waited  bool
+}
+
+// openDataInput opens dataFile, or starts dataCommand when it is set, in a
+// process group of its own with isolate. The data is read as UTF-8 from
+// encoding.
+func openDataInput(dataFile, dataCommand, encoding string, isolate bool) (*dataInput, error) {
+	if dataCommand != "" {
+		return startDataCommand(dataCommand, encoding, isolate)
+	}
+	if dataFile == stdinDataFile {
+		return &dataInput{name: "stdin", encoding: encoding, reader: newInputReader(os.Stdin, encoding)}, nil
+	}
+	return openDataFile(dataFile, encoding)
+}
+
+func openDataFile(dataFile, encoding string) (*dataInput, error) {
+	file, err := os.Open(dataFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %v", err)
+	}
+	return &dataInput{name: dataFile, path: dataFile, encoding: encoding, reader: newInputReader(file, encoding), file: file}, nil
+}
+
+// newInputReader returns a reader converting r from encoding, which buffers
+// enough data for sniffFormat
+func newInputReader(r io.Reader, encoding string) *bufio.Reader {
+	return bufio.NewReaderSize(newDecodingReader(r, encoding), sniffSampleSize)
+}
+
+// startDataCommand runs command with bash, reading rows from its stdout as
+// it produces them. Its stderr goes to xrun's stderr. With isolate it runs in a
+// process group of its own, as prepareCommand describes.
+func startDataCommand(command, encoding string, isolate bool) (*dataInput, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	release := prepareCommand(cmd, isolate)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start data command: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start data command: %v", err)
+	}
+	return &dataInput{name: "data-cmd", encoding: encoding, reader: newInputReader(stdout, encoding), cmd: cmd, cancel: cancel, release: release}, nil
+}
+
+// regular reports whether the input is a regular file, which can be opened
+// again to count its rows. A named pipe or /dev/fd path given with -d would
+// have its data read away from the rows by a second reader.
+func (in *dataInput) regular() bool {
+	if in.file == nil || in.path == "" {
+		return false
+	}
+	info, err := in.file.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// stop kills the data command, if any, so that reading its output ends
+func (in *dataInput) stop() {
+	if in.cancel != nil {
+		in.cancel()
+	}
+}
+
+// wait waits for the data command, if any, to exit once all of its output
+// has been read, and reports if it failed
+func (in *dataInput) wait() error {
+	if in.cmd == nil || in.waited {
+		return nil
+	}
+	in.waited = true
+	err := in.cmd.Wait()
+	in.release()
+	if err != nil {
+		return fmt.Errorf("data command failed: %v", err)
+	}
+	return nil
+}
+
+// Close stops the data command if it is still running and closes the input
+func (in *dataInput) Close() error {
+	if in.cmd != nil && !in.waited {
+		in.stop()
+		in.wait()
+	}
+	if in.cancel != nil {
+		in.cancel()
+	}
+	if in.file != nil {
+		return in.file.Close()
+	}
+	return nil
+}
+
+// sample returns the start of the input without consuming it. It reads only
+// as much as sniffFormat needs, so that a slow data command is not waited on
+// for longer than necessary.
+func (in *dataInput) sample() ([]byte, error) {
+	for n := 1; ; {
+		_, err := in.reader.Peek(n)
+		sample, _ := in.reader.Peek(in.reader.Buffered())
+		if err == io.EOF || err == bufio.ErrBufferFull || sniffComplete(sample) {
+			return sample, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data: %v", err)
+		}
+		n = len(sample) + 1
+	}
+}
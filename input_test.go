@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessDataFileFromStdin(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	go func() {
+		writer.WriteString("id\tname\n1\tAnna\n")
+		writer.Close()
+	}()
+
+	config := Config{
+		DataFile:   stdinDataFile,
+		Template:   "test {{.name}} = Anna",
+		NoLogFiles: true,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestProcessDataFileFromStdinNestedJSON(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	// A pretty-printed API response, as piped from curl
+	go func() {
+		writer.WriteString("{\n  \"data\": {\n    \"items\": [\n      {\"id\": 1},\n      {\"id\": 2}\n    ]\n  }\n}\n")
+		writer.Close()
+	}()
+
+	root, err := parseRowPath("data.items")
+	if err != nil {
+		t.Fatalf("Failed to parse root: %v", err)
+	}
+	config := Config{
+		DataFile:   stdinDataFile,
+		Root:       root,
+		Template:   "test {{.id}} -le 2",
+		NoLogFiles: true,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestProcessDataFileFromDataCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		dataCommand   string
+		format        string
+		template      string
+		expectedError string
+	}{
+		{
+			name:        "rows from command output",
+			dataCommand: `printf '{"n": 1}\n{"n": 2}\n'`,
+			template:    "test {{.n}} -le 2",
+		},
+		{
+			name:        "format given explicitly",
+			dataCommand: `printf 'n\n1\n'`,
+			format:      "csv",
+			template:    "test {{.n}} = 1",
+		},
+		{
+			name:          "failing data command",
+			dataCommand:   `printf '{"n": 1}\n'; exit 3`,
+			template:      "true",
+			expectedError: "data command failed: exit status 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				DataCommand: tt.dataCommand,
+				Format:      tt.format,
+				Template:    tt.template,
+				NoLogFiles:  true,
+			}
+			err := processDataFile(config)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("Expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAbortStopsDataCommand(t *testing.T) {
+	config := Config{
+		DataCommand:   `i=0; while true; do i=$((i+1)); echo "{\"n\": $i}"; sleep 0.05; done`,
+		Template:      "exit 1",
+		NoLogFiles:    true,
+		FailurePolicy: FailurePolicy{FailFast: true},
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- processDataFile(config) }()
+
+	select {
+	case err := <-done:
+		var rowErr *RowFailureError
+		if !errors.As(err, &rowErr) || !strings.Contains(rowErr.AbortReason, "--fail-fast") {
+			t.Fatalf("Expected run aborted by --fail-fast, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not stop reading from the data command after aborting")
+	}
+}
+
+func TestDataInputSampleDoesNotWaitForMoreThanNeeded(t *testing.T) {
+	in, err := startDataCommand(`echo '{"id": 1}'; sleep 30`, defaultEncoding, true)
+	if err != nil {
+		t.Fatalf("Failed to start data command: %v", err)
+	}
+	defer in.Close()
+
+	start := time.Now()
+	format, err := resolveFormat(in, autoFormat)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if format.Name != "jsonl" {
+		t.Errorf("Expected jsonl, got %s", format.Name)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Sniffing waited %s for the data command", elapsed)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestProcessDataFileFromNamedPipe(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "rows.csv")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatalf("Failed to create named pipe: %v", err)
+	}
+
+	// Far more than a pipe buffer, so that a second reader would take some
+	const rows = 30000
+	go func() {
+		writer, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer writer.Close()
+		var b strings.Builder
+		b.WriteString("id\n")
+		for i := 1; i <= rows; i++ {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+		writer.WriteString(b.String())
+	}()
+
+	count := 0
+	var lastTotal int
+	r := newRunner(func(command string, progress Progress) error {
+		count++
+		lastTotal = progress.Total
+		return nil
+	}, 1)
+	if err := processDataFileWithRunner(fifo, "echo {{.id}}", r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != rows {
+		t.Errorf("Expected %d rows, got %d", rows, count)
+	}
+	if lastTotal != 0 {
+		t.Errorf("Expected the total to stay unknown for a pipe, got %d", lastTotal)
+	}
+}
@@ -1,25 +1,56 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/csv"
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
 	"time"
 )
 
+// killGracePeriod is how long a cancelled command's process group has to exit
+// after SIGTERM before it is sent SIGKILL
+const killGracePeriod = 5 * time.Second
+
+// prepareCommand sets up how cmd is stopped when its context is cancelled.
+// With isolate it runs in a process group of its own, which is terminated as
+// a whole. Otherwise it stays in xrun's process group, so that it can prompt
+// on the terminal and receives the terminal's Ctrl-C directly, and only the
+// shell is killed. The returned function must be called once cmd.Wait has
+// returned.
+func prepareCommand(cmd *exec.Cmd, isolate bool) (release func()) {
+	if isolate {
+		return setProcessGroup(cmd, killGracePeriod)
+	}
+	cmd.WaitDelay = killGracePeriod
+	return func() {}
+}
+
 // Progress represents the current execution progress
 type Progress struct {
 	Current int
-	Total   int
+	// Total is the number of rows, or 0 while it is not known
+	Total int
+	// Attempt is the 1-based attempt number of the command, or 0 if unknown
+	Attempt int
+}
+
+// String formats the progress as [current/total], or [current/?] while the
+// total is not known
+func (p Progress) String() string {
+	if p.Total > 0 {
+		return fmt.Sprintf("[%d/%d]", p.Current, p.Total)
+	}
+	return fmt.Sprintf("[%d/?]", p.Current)
 }
 
 // CommandExecutor is a function type for executing commands with progress information
@@ -27,19 +58,56 @@ type CommandExecutor func(command string, progress Progress) error
 
 // Config holds the configuration for processing data files
 type Config struct {
-	DataFile     string
-	Template     string
-	DryRun       bool
-	NoLogFiles   bool
-	LogWriter    *LogWriter
+	DataFile       string
+	DataCommand    string
+	Format         string
+	CSV            csvDialect
+	Encoding       string
+	XLSX           xlsxOptions
+	Root           rowPath
+	Strict         bool
+	AutoEscape     string
+	Vars           map[string]any
+	VarConflict    string
+	Template       string
+	DryRun         bool
+	NoLogFiles     bool
+	Jobs           int
+	Stream         bool
+	Output         OutputMode
+	IgnoreFailures bool
+	FailurePolicy  FailurePolicy
+	RetryPolicy    RetryPolicy
+	Timeout        time.Duration
+	Deadline       time.Duration
+	StateFile      string
+	Resume         bool
+	FailedRowsFile string
+	ResultsFile    string
+	AnnotateFile   string
+	// ResultsOutputLimit is the number of bytes of each output stream kept
+	// per row in the results and annotate files (0 means no limit)
+	ResultsOutputLimit int
+	LogWriter          *LogWriter
+}
+
+// killsCommands reports whether the run may kill commands before they exit:
+// on --timeout, at the --deadline, or when a failure policy aborts the run.
+// Only then do commands run in process groups of their own, where they cannot
+// read the terminal.
+func (c Config) killsCommands() bool {
+	return c.Timeout > 0 || c.Deadline > 0 || c.FailurePolicy != (FailurePolicy{})
 }
 
-// LogWriter handles writing to log files
+// LogWriter handles writing to log files. It is safe for concurrent use.
 type LogWriter struct {
+	mu   sync.Mutex
 	file *os.File
 }
 
 func (lw *LogWriter) Write(p []byte) (n int, err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
 	if lw.file != nil {
 		return lw.file.Write(p)
 	}
@@ -47,6 +115,8 @@ func (lw *LogWriter) Write(p []byte) (n int, err error) {
 }
 
 func (lw *LogWriter) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
 	if lw.file != nil {
 		return lw.file.Close()
 	}
@@ -55,18 +125,235 @@ func (lw *LogWriter) Close() error {
 
 func main() {
 	var dataFile string
+	var dataCommand string
+	var formatName string
 	var execTemplate string
 	var inputFile string
 	var dryRun bool
 	var noLogFiles bool
-
-	flag.StringVar(&dataFile, "d", "", "Path to the data file (CSV/JSON/JSONL)")
+	var jobs int
+	var stream bool
+	var outputMode string
+	var ignoreFailures bool
+	var failFast bool
+	var maxFailures int
+	var maxFailureRate string
+	var retries int
+	var retryDelay time.Duration
+	var retryOnExit string
+	var timeout time.Duration
+	var deadline time.Duration
+	var stateFile string
+	var resume bool
+	var failedRowsFile string
+	var resultsFile string
+	var resultsOutputLimit int
+	var annotateFile string
+	var delimiter string
+	var comment string
+	var noHeader bool
+	var columns string
+	var lazyQuotes bool
+	var variableFields bool
+	var trimLeadingSpace bool
+	var encodingName string
+	var sheet string
+	var headerRow int
+	var cells string
+	var rootPath string
+	var strict bool
+	var autoEscape string
+	vars := varFlags{}
+	var varsFile string
+	var varConflict string
+
+	flag.StringVar(&dataFile, "d", "", "Path to the data file (CSV/TSV/JSON/JSONL/XLSX/YAML/TOML), or - to read it from stdin")
+	flag.StringVar(&dataCommand, "data-cmd", "", "Shell command whose output is used as the data")
+	flag.StringVar(&formatName, "format", autoFormat, "Data file format: "+strings.Join(formatNames(), ", ")+" or auto to detect it")
+	flag.StringVar(&encodingName, "encoding", defaultEncoding, "Character encoding of the data: utf-8, utf-16le, utf-16be, shift_jis or latin-1")
+	flag.StringVar(&sheet, "sheet", "", "Name or 1-based position of the XLSX worksheet to read (default the first)")
+	flag.IntVar(&headerRow, "header-row", 0, "Row of the XLSX worksheet holding the column names (default the first row with values)")
+	flag.StringVar(&cells, "range", "", "Cells of the XLSX worksheet to read, e.g. A1:D100 or B:F")
+	flag.StringVar(&rootPath, "root", "", "Path to the rows inside JSON, JSONL, YAML or TOML documents, e.g. data.items")
+	flag.StringVar(&delimiter, "delimiter", "", "Field delimiter of CSV data, e.g. ; or \\t")
+	flag.StringVar(&comment, "comment", "", "Skip CSV lines starting with this character")
+	flag.BoolVar(&noHeader, "no-header", false, "CSV data has no header line; columns are named c1, c2, ... unless --columns is given")
+	flag.StringVar(&columns, "columns", "", "Comma-separated column names for CSV data, replacing the header line's names")
+	flag.BoolVar(&lazyQuotes, "lazy-quotes", false, "Accept quotes inside unquoted CSV fields")
+	flag.BoolVar(&variableFields, "variable-fields", false, "Accept CSV rows with more or fewer fields than the header")
+	flag.BoolVar(&trimLeadingSpace, "trim-leading-space", false, "Ignore white space at the start of CSV fields")
 	flag.StringVar(&execTemplate, "e", "", "Command template to execute for each row")
 	flag.StringVar(&inputFile, "i", "", "Path to file containing command template")
+	flag.BoolVar(&strict, "strict", false, "Fail on template fields missing from the data, checking the first row before running anything")
+	flag.StringVar(&autoEscape, "auto-escape", autoEscapeNone, "Escape substituted values: none, or shell to quote them for the shell")
+	flag.Var(vars, "v", "Set the template variable key to value, as in -v key=value (may be repeated)")
+	flag.StringVar(&varsFile, "vars", "", "Read template variables from this JSON object file")
+	flag.StringVar(&varConflict, "var-conflict", varConflictRow, "When a row has a field named like a variable, use the row's value, the variable's (vars), or fail (error)")
 	flag.BoolVar(&dryRun, "dry-run", false, "Print commands to stdout instead of executing them")
 	flag.BoolVar(&noLogFiles, "no-log-files", false, "Skip logging execution output to files")
+	flag.IntVar(&jobs, "j", 1, "Number of commands to run in parallel")
+	flag.BoolVar(&stream, "stream", false, "Start running rows immediately and count the data file in the background")
+	flag.StringVar(&outputMode, "output", string(OutputInterleaved), "Output mode: interleaved, grouped, ordered or prefixed")
+	flag.BoolVar(&ignoreFailures, "ignore-failures", false, "Exit with status 0 even if some rows fail")
+	flag.BoolVar(&failFast, "fail-fast", false, "Abort the run on the first failing row")
+	flag.IntVar(&maxFailures, "max-failures", 0, "Abort the run once N rows have failed")
+	flag.StringVar(&maxFailureRate, "max-failure-rate", "", "Abort the run once P% of finished rows have failed")
+	flag.IntVar(&retries, "retries", 0, "Retry failed commands up to N times")
+	flag.DurationVar(&retryDelay, "retry-delay", time.Second, "Initial delay between retries, doubled on every attempt")
+	flag.StringVar(&retryOnExit, "retry-on-exit", "", "Only retry commands exiting with one of these comma-separated codes")
+	flag.DurationVar(&timeout, "timeout", 0, "Kill commands that run longer than this duration (e.g. 30s)")
+	flag.DurationVar(&deadline, "deadline", 0, "Abort the whole run after this duration (e.g. 2h)")
+	flag.StringVar(&stateFile, "state", "", "Record row outcomes in this file so the run can be resumed")
+	flag.BoolVar(&resume, "resume", false, "Skip rows that already succeeded according to --state")
+	flag.StringVar(&failedRowsFile, "failed-rows", "", "Write rows that did not succeed to this file, in the data file's format")
+	flag.StringVar(&resultsFile, "results", "", "Write a JSON Lines record describing every row to this file")
+	flag.IntVar(&resultsOutputLimit, "results-output-limit", defaultResultsOutputLimit, "Keep at most N bytes of each row's stdout and stderr in --results and --annotate (0 means no limit)")
+	flag.StringVar(&annotateFile, "annotate", "", "Write the input rows with result columns added to this file, in the data file's format")
 	flag.Parse()
 
+	// `xrun rerun <failed-rows-file> [options]` runs the rows written by
+	// --failed-rows with the template recorded next to them
+	var rerunFile string
+	if flag.Arg(0) == "rerun" {
+		if flag.NArg() < 2 {
+			fmt.Fprintf(os.Stderr, "Usage: %s rerun <failed-rows-file> [options]\n", os.Args[0])
+			os.Exit(1)
+		}
+		rerunFile = flag.Arg(1)
+		// Options may also follow the failed rows file
+		flag.CommandLine.Parse(flag.Args()[2:])
+	}
+
+	if jobs < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -j must be at least 1\n")
+		os.Exit(1)
+	}
+
+	output, err := parseOutputMode(outputMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if retries < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --retries must not be negative\n")
+		os.Exit(1)
+	}
+	retryPolicy := RetryPolicy{Retries: retries, Delay: retryDelay, MaxDelay: maxRetryDelay}
+	if retryOnExit != "" {
+		retryPolicy.OnExitCodes, err = parseExitCodes(retryOnExit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if timeout < 0 || deadline < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --timeout and --deadline must not be negative\n")
+		os.Exit(1)
+	}
+
+	if resume && stateFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --resume requires --state\n")
+		os.Exit(1)
+	}
+
+	if resultsOutputLimit < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --results-output-limit must not be negative\n")
+		os.Exit(1)
+	}
+
+	if maxFailures < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-failures must not be negative\n")
+		os.Exit(1)
+	}
+	failurePolicy := FailurePolicy{FailFast: failFast, MaxFailures: maxFailures}
+	if maxFailureRate != "" {
+		failurePolicy.MaxFailureRate, err = parseFailureRate(maxFailureRate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	dataEncoding, err := parseEncoding(encodingName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if headerRow < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --header-row must not be negative\n")
+		os.Exit(1)
+	}
+	xlsx := xlsxOptions{sheet: sheet, headerRow: headerRow}
+	if cells != "" {
+		xlsx.cells, err = parseCellRange(cells)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	autoEscape, err = parseAutoEscape(autoEscape)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	varConflict, err = parseVarConflict(varConflict)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var fileVars map[string]any
+	if varsFile != "" {
+		fileVars, err = loadVars(varsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	variables, err := templateVariables(fileVars, vars)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	root, err := parseRowPath(rootPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	csvOptions := csvDialect{
+		noHeader:         noHeader,
+		lazyQuotes:       lazyQuotes,
+		variableFields:   variableFields,
+		trimLeadingSpace: trimLeadingSpace,
+	}
+	if delimiter != "" {
+		csvOptions.comma, err = parseDelimiter(delimiter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if comment != "" {
+		csvOptions.comment, err = parseDelimiter(comment)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid comment character %q (expected a single character)\n", comment)
+			os.Exit(1)
+		}
+	}
+	if columns != "" {
+		csvOptions.columns, err = parseColumns(columns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Validate mutual exclusivity of -e and -i flags
 	if execTemplate != "" && inputFile != "" {
 		fmt.Fprintf(os.Stderr, "Error: -e and -i flags are mutually exclusive\n")
@@ -86,15 +373,111 @@ func main() {
 		template = execTemplate
 	}
 
-	if dataFile != "" && template != "" {
+	if dataFile != "" && dataCommand != "" {
+		fmt.Fprintf(os.Stderr, "Error: -d and --data-cmd cannot be used together\n")
+		os.Exit(1)
+	}
+
+	if rerunFile != "" {
+		if dataFile != "" || dataCommand != "" || template != "" {
+			fmt.Fprintf(os.Stderr, "Error: rerun takes the data and template from the failed rows file; -d, --data-cmd, -e and -i cannot be used\n")
+			os.Exit(1)
+		}
+		if len(root) > 0 {
+			// Failed rows are written without the documents around them
+			fmt.Fprintf(os.Stderr, "Error: --root cannot be used with rerun\n")
+			os.Exit(1)
+		}
+		manifest, err := readRerunManifest(rerunFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		dataFile = rerunFile
+		template = manifest.Template
+		if formatName == autoFormat && manifest.Format != "" {
+			formatName = manifest.Format
+		}
+		strict = strict || manifest.Strict
+		if autoEscape == autoEscapeNone && manifest.AutoEscape != "" {
+			// The template may rely on values being quoted for the shell
+			autoEscape, err = parseAutoEscape(manifest.AutoEscape)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid rerun manifest: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if len(manifest.Vars) > 0 {
+			// Variables given to rerun take precedence over the recorded ones
+			for key, value := range fileVars {
+				manifest.Vars[key] = value
+			}
+			variables, err = templateVariables(manifest.Vars, vars)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if varConflict == varConflictRow && manifest.VarConflict != "" {
+			varConflict, err = parseVarConflict(manifest.VarConflict)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid rerun manifest: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if manifest.CSV != nil {
+			if delimiter == "" && manifest.CSV.Delimiter != "" {
+				csvOptions.comma, err = parseDelimiter(manifest.CSV.Delimiter)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid rerun manifest: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			csvOptions.noHeader = csvOptions.noHeader || manifest.CSV.NoHeader
+			if columns == "" && manifest.CSV.Columns != nil {
+				csvOptions.columns = manifest.CSV.Columns
+			}
+			csvOptions.variableFields = csvOptions.variableFields || manifest.CSV.VariableFields
+		}
+	}
+
+	if (dataFile != "" || dataCommand != "") && template != "" {
 		config := Config{
-			DataFile:   dataFile,
-			Template:   template,
-			DryRun:     dryRun,
-			NoLogFiles: noLogFiles,
+			DataFile:           dataFile,
+			DataCommand:        dataCommand,
+			Format:             formatName,
+			CSV:                csvOptions,
+			Encoding:           dataEncoding,
+			XLSX:               xlsx,
+			Root:               root,
+			Strict:             strict,
+			AutoEscape:         autoEscape,
+			Vars:               variables,
+			VarConflict:        varConflict,
+			Template:           template,
+			DryRun:             dryRun,
+			NoLogFiles:         noLogFiles,
+			Jobs:               jobs,
+			Stream:             stream,
+			Output:             output,
+			IgnoreFailures:     ignoreFailures,
+			FailurePolicy:      failurePolicy,
+			RetryPolicy:        retryPolicy,
+			Timeout:            timeout,
+			Deadline:           deadline,
+			StateFile:          stateFile,
+			Resume:             resume,
+			FailedRowsFile:     failedRowsFile,
+			ResultsFile:        resultsFile,
+			AnnotateFile:       annotateFile,
+			ResultsOutputLimit: resultsOutputLimit,
 		}
 		if err := processDataFile(config); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			var rowErr *RowFailureError
+			if errors.As(err, &rowErr) {
+				os.Exit(exitRowFailures)
+			}
 			os.Exit(1)
 		}
 		return
@@ -111,6 +494,10 @@ func main() {
 	case "version":
 		fmt.Println("xrun v0.1.0")
 	case "help":
+		if len(os.Args) > 2 && os.Args[2] == "functions" {
+			showFunctionsHelp()
+			return
+		}
 		showHelp()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
@@ -140,9 +527,84 @@ func createLogWriter(dataFile string) (*LogWriter, error) {
 }
 
 func processDataFile(config Config) error {
+	in, err := openDataInput(config.DataFile, config.DataCommand, config.Encoding, config.killsCommands())
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	format, err := resolveFormat(in, config.Format)
+	if err != nil {
+		return err
+	}
+	format, err = applyCSVDialect(format, config.CSV)
+	if err != nil {
+		return err
+	}
+	format, err = applyXLSXOptions(format, config.XLSX)
+	if err != nil {
+		return err
+	}
+	format, err = applyRoot(format, config.Root)
+	if err != nil {
+		return err
+	}
+	if format.xlsx != nil && config.Encoding != "" && config.Encoding != defaultEncoding {
+		return fmt.Errorf("--encoding cannot be used with xlsx data")
+	}
+
+	var failedRows *failedRowsWriter
+	if config.FailedRowsFile != "" && !config.DryRun {
+		failedFormat, ok := outputFormat(config.FailedRowsFile, format)
+		if !ok {
+			return fmt.Errorf("failed rows file %s must use the same format as the data file (%s)", config.FailedRowsFile, format.Name)
+		}
+		if in.path != "" && filepath.Clean(config.FailedRowsFile) == filepath.Clean(in.path) {
+			return fmt.Errorf("failed rows file must not be the data file itself")
+		}
+		failedRows = newFailedRowsWriter(config.FailedRowsFile, failedFormat)
+	}
+
+	// Open the state file first, so that refusing to replay a finished run
+	// leaves nothing behind
+	var state *StateFile
+	if config.StateFile != "" && !config.DryRun {
+		state, err = openStateFile(config.StateFile, config.Resume)
+		if err != nil {
+			return err
+		}
+		defer state.Close()
+	}
+
+	var annotate *annotateWriter
+	if config.AnnotateFile != "" && !config.DryRun {
+		annotateFormat, ok := outputFormat(config.AnnotateFile, format)
+		if !ok {
+			return fmt.Errorf("annotate file %s must use the same format as the data file (%s)", config.AnnotateFile, format.Name)
+		}
+		if in.path != "" && filepath.Clean(config.AnnotateFile) == filepath.Clean(in.path) {
+			return fmt.Errorf("annotate file must not be the data file itself")
+		}
+		annotate = newAnnotateWriter(config.AnnotateFile, annotateFormat)
+	}
+
+	var results *resultsWriter
+	if config.ResultsFile != "" && !config.DryRun {
+		results, err = newResultsWriter(config.ResultsFile)
+		if err != nil {
+			return fmt.Errorf("failed to create results file: %v", err)
+		}
+		defer results.Close()
+	}
+
+	var captures *outputCaptures
+	if results != nil || annotate != nil {
+		captures = newOutputCaptures(config.ResultsOutputLimit)
+	}
+
 	// Set up log writer if needed
 	if !config.DryRun && !config.NoLogFiles {
-		logWriter, err := createLogWriter(config.DataFile)
+		logWriter, err := createLogWriter(in.name)
 		if err != nil {
 			return fmt.Errorf("failed to create log file: %v", err)
 		}
@@ -151,28 +613,110 @@ func processDataFile(config Config) error {
 	}
 	
 	// Create command executor
-	var executor CommandExecutor
+	var executor contextExecutor
+	var outputs *outputCoordinator
 	if config.DryRun {
-		executor = func(command string, progress Progress) error {
+		executor = func(ctx context.Context, command string, progress Progress) error {
 			return printCommand(command)
 		}
 	} else {
-		executor = func(command string, progress Progress) error {
-			return executeCommandWithProgressAndLogging(command, progress.Current, progress.Total, config.LogWriter)
+		outputs = newOutputCoordinator(config.Output, config.LogWriter)
+		if captures != nil {
+			outputs.capture = captures.capture
+		}
+		executor = func(ctx context.Context, command string, progress Progress) error {
+			out := outputs.begin(progress)
+			defer out.finish()
+			return runCommand(ctx, command, progress, out, config.killsCommands())
 		}
 	}
 	
-	ext := strings.ToLower(filepath.Ext(config.DataFile))
-	
-	switch ext {
-	case ".json":
-		return processJSONWithExecutor(config.DataFile, config.Template, executor)
-	case ".jsonl":
-		return processJSONLWithExecutor(config.DataFile, config.Template, executor)
-	default:
-		// Fallback to CSV for unknown extensions or .csv
-		return processCSVWithExecutor(config.DataFile, config.Template, executor)
+	r := newContextRunner(executor, config.Jobs)
+	r.outputs = outputs
+	r.stream = config.Stream
+	r.policy = config.FailurePolicy
+	r.retry = config.RetryPolicy
+	r.timeout = config.Timeout
+	r.state = state
+	r.failedRows = failedRows
+	r.results = results
+	r.annotate = annotate
+	r.captures = captures
+	r.templates = templateOptions{
+		strict:      config.Strict,
+		autoEscape:  config.AutoEscape,
+		vars:        config.Vars,
+		varConflict: config.VarConflict,
+	}
+	// The deadline and interrupts are watched only while rows run, so that
+	// neither aborts the run while it is being summarized
+	var stopWatching []func() bool
+	if config.Deadline > 0 {
+		deadlineCtx, cancel := context.WithTimeout(context.Background(), config.Deadline)
+		defer cancel()
+		stopWatching = append(stopWatching, r.abortWhenDone(deadlineCtx, fmt.Sprintf("--deadline %s reached", config.Deadline)))
+	}
+	if !config.DryRun {
+		// Commands in process groups of their own do not see the terminal's
+		// interrupt; cancel them ourselves, and abort the run so that the
+		// remaining rows are skipped. A second interrupt kills xrun
+		// immediately.
+		interruptCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		stopWatching = append(stopWatching, r.abortWhenDone(interruptCtx, "interrupted"))
+		context.AfterFunc(interruptCtx, stop)
+	}
+	// Once rows have run, an error reading the rest of the data still writes
+	// the files and summary for them before it is reported
+	readErr := processInput(in, format, config.Template, r)
+	for _, stop := range stopWatching {
+		stop()
+	}
+	if readErr != nil && r.summary.Total() == 0 {
+		return readErr
+	}
+
+	if annotate != nil {
+		if err := annotate.Close(); err != nil {
+			return fmt.Errorf("failed to write annotate file: %v", err)
+		}
+	}
+	if failedRows != nil {
+		manifest := rerunManifest{Template: config.Template, Source: config.DataFile, Strict: config.Strict}
+		if config.AutoEscape != autoEscapeNone {
+			manifest.AutoEscape = config.AutoEscape
+		}
+		manifest.Vars = config.Vars
+		if config.VarConflict != varConflictRow {
+			manifest.VarConflict = config.VarConflict
+		}
+		if config.DataCommand != "" {
+			manifest.Source = config.DataCommand
+		}
+		if config.Format != "" && config.Format != autoFormat {
+			manifest.Format = format.Name
+		}
+		manifest.CSV = newManifestCSV(failedRows.rows.format)
+		if err := failedRows.Close(manifest); err != nil {
+			return fmt.Errorf("failed to write failed rows file: %v", err)
+		}
+	}
+
+	if !config.DryRun {
+		r.summary.Print(os.Stderr)
+	}
+	if failedRows != nil && failedRows.count > 0 {
+		fmt.Fprintf(os.Stderr, "%d rows written to %s, run them again with: xrun rerun %s\n",
+			failedRows.count, config.FailedRowsFile, config.FailedRowsFile)
 	}
+	failed := r.summary.FailureCount()
+	if readErr != nil {
+		return &RowFailureError{Failed: failed, Total: r.summary.Total(), Err: readErr}
+	}
+	if r.aborted() || (failed > 0 && !config.IgnoreFailures) {
+		return &RowFailureError{Failed: failed, Total: r.summary.Total(), AbortReason: r.abortCause()}
+	}
+	return nil
 }
 
 func processDataFileWithDryRun(dataFile, execTemplate string, dryRun bool) error {
@@ -196,206 +740,64 @@ func processDataFileWithOptions(dataFile, execTemplate string, dryRun, noLogFile
 }
 
 func processDataFileWithExecutor(dataFile, execTemplate string, executor CommandExecutor) error {
-	ext := strings.ToLower(filepath.Ext(dataFile))
-	
-	switch ext {
-	case ".json":
-		return processJSONWithExecutor(dataFile, execTemplate, executor)
-	case ".jsonl":
-		return processJSONLWithExecutor(dataFile, execTemplate, executor)
-	default:
-		// Fallback to CSV for unknown extensions or .csv
-		return processCSVWithExecutor(dataFile, execTemplate, executor)
-	}
+	return processDataFileWithRunner(dataFile, execTemplate, newRunner(executor, 1))
 }
 
-
-// processCSVWithExecutor handles CSV processing with an injectable command executor
-func processCSVWithExecutor(dataFile, execTemplate string, executor CommandExecutor) error {
-	file, err := os.Open(dataFile)
+func processDataFileWithRunner(dataFile, execTemplate string, r *runner) error {
+	in, err := openDataFile(dataFile, defaultEncoding)
 	if err != nil {
-		return fmt.Errorf("failed to open data file: %v", err)
+		return err
 	}
-	defer file.Close()
+	defer in.Close()
 
-	reader := csv.NewReader(file)
-	
-	headers, err := reader.Read()
+	format, err := resolveFormat(in, autoFormat)
 	if err != nil {
-		return fmt.Errorf("failed to read CSV headers: %v", err)
-	}
-
-	// Read all rows first to get total count
-	var allRows [][]string
-	for {
-		row, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to read CSV row: %v", err)
-		}
-		allRows = append(allRows, row)
+		return err
 	}
-
-	tmpl, err := template.New("command").Parse(execTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %v", err)
-	}
-
-	total := len(allRows)
-	for i, row := range allRows {
-		data := make(map[string]string)
-		for j, header := range headers {
-			if j < len(row) {
-				data[header] = row[j]
-			}
-		}
-
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, data); err != nil {
-			fmt.Fprintf(os.Stderr, "Template execution error for row %v: %v\n", row, err)
-			continue
-		}
-
-		command := buf.String()
-		progress := Progress{Current: i + 1, Total: total}
-		if err := executor(command, progress); err != nil {
-			fmt.Fprintf(os.Stderr, "Command execution error: %v\n", err)
-		}
-	}
-
-	return nil
+	return processInput(in, format, execTemplate, r)
 }
 
-// processJSONWithExecutor handles JSON array processing with an injectable command executor
-func processJSONWithExecutor(dataFile, execTemplate string, executor CommandExecutor) error {
-	file, err := os.Open(dataFile)
-	if err != nil {
-		return fmt.Errorf("failed to open data file: %v", err)
-	}
-	defer file.Close()
-
-	var data []map[string]any
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&data); err != nil {
-		return fmt.Errorf("failed to parse JSON: %v", err)
-	}
+// attemptField is the template variable holding the current attempt number,
+// unless the row has a field of the same name
+const attemptField = "xrun_attempt"
 
-	tmpl, err := template.New("command").Parse(execTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %v", err)
-	}
+// metaField is the template variable describing the row and the run, as in
+// {{$.xrun.index}}, unless the row has a field of the same name
+const metaField = "xrun"
 
-	total := len(data)
-	for i, row := range data {
-		// Convert interface{} values to strings for template compatibility
-		stringRow := make(map[string]string)
-		for key, value := range row {
-			if value == nil {
-				stringRow[key] = ""
-			} else {
-				switch v := value.(type) {
-				case string:
-					stringRow[key] = v
-				case float64:
-					stringRow[key] = fmt.Sprintf("%g", v)
-				case bool:
-					stringRow[key] = fmt.Sprintf("%t", v)
-				default:
-					// For complex types, convert to JSON string
-					jsonBytes, _ := json.Marshal(v)
-					stringRow[key] = string(jsonBytes)
-				}
-			}
-		}
+// renderFunc renders the command for a row on the given attempt, starting at 1
+type renderFunc func(attempt int) (string, error)
 
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, stringRow); err != nil {
-			fmt.Fprintf(os.Stderr, "Template execution error for row %v: %v\n", row, err)
-			continue
-		}
-
-		command := buf.String()
-		progress := Progress{Current: i + 1, Total: total}
-		if err := executor(command, progress); err != nil {
-			fmt.Fprintf(os.Stderr, "Command execution error: %v\n", err)
-		}
+// templateVars returns the variables a row's command is rendered with on the
+// given attempt: the row's data, with attemptField and metaField added
+func templateVars(data map[string]any, meta rowMeta, attempt int) map[string]any {
+	vars := make(map[string]any, len(data)+2)
+	for key, value := range data {
+		vars[key] = value
 	}
-
-	return nil
-}
-
-// processJSONLWithExecutor handles JSONL (JSON Lines) processing with an injectable command executor
-func processJSONLWithExecutor(dataFile, execTemplate string, executor CommandExecutor) error {
-	file, err := os.Open(dataFile)
-	if err != nil {
-		return fmt.Errorf("failed to open data file: %v", err)
+	if _, ok := data[attemptField]; !ok {
+		vars[attemptField] = attempt
 	}
-	defer file.Close()
-
-	tmpl, err := template.New("command").Parse(execTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %v", err)
+	if _, ok := data[metaField]; !ok {
+		vars[metaField] = meta.vars(attempt)
 	}
+	return vars
+}
 
-	// Read all lines first to get total count
-	var allLines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" { // Skip empty lines
-			allLines = append(allLines, line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading JSONL file: %v", err)
-	}
-
-	total := len(allLines)
-	for i, line := range allLines {
-		var row map[string]any
-		if err := json.Unmarshal([]byte(line), &row); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to parse JSON on line %d: %v\n", i+1, err)
-			continue
-		}
-
-		// Convert interface{} values to strings for template compatibility
-		stringRow := make(map[string]string)
-		for key, value := range row {
-			if value == nil {
-				stringRow[key] = ""
-			} else {
-				switch v := value.(type) {
-				case string:
-					stringRow[key] = v
-				case float64:
-					stringRow[key] = fmt.Sprintf("%g", v)
-				case bool:
-					stringRow[key] = fmt.Sprintf("%t", v)
-				default:
-					// For complex types, convert to JSON string
-					jsonBytes, _ := json.Marshal(v)
-					stringRow[key] = string(jsonBytes)
-				}
-			}
-		}
-
+// templateRenderer returns a renderFunc executing tmpl against a row's data
+func templateRenderer(tmpl *template.Template, data map[string]any, meta rowMeta) renderFunc {
+	return func(attempt int) (string, error) {
 		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, stringRow); err != nil {
-			fmt.Fprintf(os.Stderr, "Template execution error for line %d: %v\n", i+1, err)
-			continue
-		}
-
-		command := buf.String()
-		progress := Progress{Current: i + 1, Total: total}
-		if err := executor(command, progress); err != nil {
-			fmt.Fprintf(os.Stderr, "Command execution error: %v\n", err)
+		if err := tmpl.Execute(&buf, templateVars(data, meta, attempt)); err != nil {
+			return "", err
 		}
+		return buf.String(), nil
 	}
+}
 
-	return nil
+// processCSVWithExecutor handles CSV processing with an injectable command executor
+func processCSVWithExecutor(dataFile, execTemplate string, executor CommandExecutor) error {
+	return processFile(dataFile, formats["csv"], execTemplate, newRunner(executor, 1))
 }
 
 func executeCommand(command string, progress Progress) error {
@@ -404,69 +806,186 @@ func executeCommand(command string, progress Progress) error {
 
 
 func executeCommandWithProgressAndLogging(command string, current int, total int, logWriter *LogWriter) error {
+	progress := Progress{Current: current, Total: total}
+	out := newOutputCoordinator(OutputInterleaved, logWriter).begin(progress)
+	defer out.finish()
+	return runCommand(context.Background(), command, progress, out, false)
+}
+
+// runCommand announces command and runs it, sending its output to out. The
+// command is stopped as prepareCommand describes if ctx is cancelled before
+// it exits.
+func runCommand(ctx context.Context, command string, progress Progress, out *jobOutput, isolate bool) error {
 	if strings.TrimSpace(command) == "" {
 		return fmt.Errorf("empty command")
 	}
 
-	cmd := exec.Command("bash", "-c", command)
-	
-	// Create multi-writers to output to both console and log file
-	var stdoutWriter, stderrWriter io.Writer
-	if logWriter != nil {
-		stdoutWriter = io.MultiWriter(os.Stdout, logWriter)
-		stderrWriter = io.MultiWriter(os.Stderr, logWriter)
-	} else {
-		stdoutWriter = os.Stdout
-		stderrWriter = os.Stderr
-	}
-	
-	cmd.Stdout = stdoutWriter
-	cmd.Stderr = stderrWriter
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	release := prepareCommand(cmd, isolate)
+	defer release()
+	cmd.Stdout = out.Stdout
+	cmd.Stderr = out.Stderr
 	
 	// Format the log with timestamp and progress
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	var logMessage string
-	if current > 0 && total > 0 {
-		logMessage = fmt.Sprintf("[%d/%d] %s Executing: %s", current, total, timestamp, command)
+	action := "Executing"
+	if progress.Attempt > 1 {
+		action = fmt.Sprintf("Executing (attempt %d)", progress.Attempt)
+	}
+	if progress.Current > 0 {
+		logMessage = fmt.Sprintf("%s %s %s: %s", progress, timestamp, action, command)
 	} else {
-		logMessage = fmt.Sprintf("%s Executing: %s", timestamp, command)
+		logMessage = fmt.Sprintf("%s %s: %s", timestamp, action, command)
 	}
 	
-	fmt.Println(logMessage)
-	if logWriter != nil {
-		fmt.Fprintln(logWriter, logMessage)
-	}
+	out.announce(logMessage)
 	
 	return cmd.Run()
 }
 
-
 func printCommand(command string) error {
 	fmt.Println(command)
 	return nil
 }
 
+// showFunctionsHelp lists the functions available in command templates
+func showFunctionsHelp() {
+	fmt.Println("xrun template functions")
+	fmt.Println("\nFunctions taking a value take it last, so that they can be chained:")
+	fmt.Println("  {{.name | trim | lower}}   {{.id | padLeft 6 \"0\"}}   {{add .count 1}}")
+	for _, group := range templateFuncGroups {
+		fmt.Printf("\n%s:\n", group.name)
+		for _, f := range group.funcs {
+			if len(f.usage) > 26 {
+				fmt.Printf("  %s\n  %-26s %s\n", f.usage, "", f.description)
+			} else {
+				fmt.Printf("  %-26s %s\n", f.usage, f.description)
+			}
+		}
+	}
+	fmt.Println("\nGo's builtin functions can be used as well: printf, print, index, len, slice, eq, ne, lt, le,")
+	fmt.Println("gt, ge, and, or and not. See https://pkg.go.dev/text/template#hdr-Functions")
+}
+
 func showHelp() {
 	fmt.Println("xrun - CLI tool")
 	fmt.Println("\nUsage:")
 	fmt.Println("  xrun <command>")
-	fmt.Println("  xrun -d <data-file> (-e \"<command-template>\" | -i <input-file>) [--dry-run] [--no-log-files]")
+	fmt.Println("  xrun rerun <failed-rows-file> [options]")
+	fmt.Println("  xrun (-d <data-file> | -d - | --data-cmd <command>) [--format <name>] [--encoding <name>] (-e \"<command-template>\" | -i <input-file>) [--strict] [--auto-escape <mode>] [-v key=value] [--vars <file>] [--var-conflict <policy>] [--dry-run] [--no-log-files] [-j N] [--stream] [--output <mode>] [--ignore-failures]")
+	fmt.Println("       [--fail-fast | --max-failures N | --max-failure-rate P%]")
+	fmt.Println("       [--retries N [--retry-delay <duration>] [--retry-on-exit <codes>]]")
+	fmt.Println("       [--timeout <duration>] [--deadline <duration>] [--state <file> [--resume]]")
+	fmt.Println("       [--failed-rows <file>] [--results <file>] [--annotate <file>] [--results-output-limit N]")
+	fmt.Println("       [--delimiter <char>] [--comment <char>] [--no-header] [--columns <names>]")
+	fmt.Println("       [--lazy-quotes] [--variable-fields] [--trim-leading-space]")
+	fmt.Println("       [--sheet <name|N>] [--header-row N] [--range <cells>] [--root <path>]")
 	fmt.Println("\nCommands:")
 	fmt.Println("  version    Show version information")
-	fmt.Println("  help       Show this help message")
+	fmt.Println("  help       Show this help message (help functions lists the template functions)")
+	fmt.Println("  rerun      Run the rows in a --failed-rows file again with the same template")
 	fmt.Println("\nData processing options:")
-	fmt.Println("  -d              Path to the data file (CSV/JSON/JSONL)")
+	fmt.Println("  -d              Path to the data file (CSV/TSV/JSON/JSONL/XLSX/YAML/TOML), or - to read it from stdin")
+	fmt.Println("  --data-cmd <command>")
+	fmt.Println("                  Run a shell command and use its output as the data, instead of -d")
+	fmt.Println("  --format <name> Data file format: csv, tsv, json, jsonl, xlsx, yaml, toml or auto (default auto)")
+	fmt.Println("  --encoding <name>")
+	fmt.Println("                  Character encoding of the data: utf-8, utf-16le, utf-16be, shift_jis or latin-1")
+	fmt.Println("                  (default utf-8; byte order marks are removed and select UTF-16 automatically)")
 	fmt.Println("  -e              Command template to execute for each row")
 	fmt.Println("  -i              Path to file containing command template")
+	fmt.Println("  --strict        Fail rows missing a field the template uses instead of substituting <no value>;")
+	fmt.Println("                  the first row is checked before any command runs")
+	fmt.Println("  --auto-escape <mode>")
+	fmt.Println("                  shell: quote every substituted value for the shell quotes around it;")
+	fmt.Println("                  none: substitute values as they are (default)")
+	fmt.Println("  -v key=value    Set the template variable {{.key}} for every row (may be repeated)")
+	fmt.Println("  --vars <file>   Read template variables from a JSON object file; -v takes precedence")
+	fmt.Println("  --var-conflict <policy>")
+	fmt.Println("                  When a row has a field named like a variable: row uses the row's value (default),")
+	fmt.Println("                  vars the variable's, and error aborts the run (or fails later rows)")
 	fmt.Println("  --dry-run       Print commands to stdout instead of executing them")
 	fmt.Println("  --no-log-files  Skip logging execution output to files")
+	fmt.Println("  -j N            Run up to N commands in parallel (default 1)")
+	fmt.Println("  --stream        Start running rows immediately instead of counting the data file first;")
+	fmt.Println("                  progress shows [current/?] until the background count finishes")
+	fmt.Println("  --output <mode> How command output is written (default interleaved):")
+	fmt.Println("                    interleaved  write output as soon as it is produced")
+	fmt.Println("                    grouped      write each command's output as one block when it finishes")
+	fmt.Println("                    ordered      like grouped, but blocks follow input row order")
+	fmt.Println("                    prefixed     prefix every output line with [current/total]")
+	fmt.Println("  --ignore-failures  Exit with status 0 even if some rows fail")
+	fmt.Println("  --fail-fast        Abort the run on the first failing row")
+	fmt.Println("  --max-failures N   Abort the run once N rows have failed")
+	fmt.Println("  --max-failure-rate P%")
+	fmt.Println("                     Abort the run once P% of finished rows have failed")
+	fmt.Println("  --retries N        Retry failed commands up to N times with exponential backoff")
+	fmt.Println("  --retry-delay <duration>")
+	fmt.Println("                     Initial delay between retries (default 1s)")
+	fmt.Println("  --retry-on-exit <codes>")
+	fmt.Println("                     Only retry commands exiting with one of these codes, e.g. 7,28,56")
+	fmt.Println("  --timeout <duration>")
+	fmt.Println("                     Kill commands running longer than this, e.g. 30s")
+	fmt.Println("  --deadline <duration>")
+	fmt.Println("                     Abort the whole run after this long, e.g. 2h")
+	fmt.Println("                     With --timeout, --deadline, --fail-fast or --max-failures/-rate, commands run")
+	fmt.Println("                     in their own process groups and cannot prompt on the terminal (e.g. ssh or sudo)")
+	fmt.Println("  --state <file>     Record the outcome of every row in this file")
+	fmt.Println("  --resume           Continue the run recorded in --state, skipping rows that succeeded")
+	fmt.Println("  --failed-rows <file>")
+	fmt.Println("                     Write rows that did not succeed to this file, in the data file's format")
+	fmt.Println("  --results <file>   Write a JSON Lines record for every row: input, command, timestamps,")
+	fmt.Println("                     duration, exit code, signal, attempts and captured output")
+	fmt.Println("  --annotate <file>  Write the input rows to this file, in the data file's format, with the columns")
+	fmt.Println("                     xrun_status, xrun_exit_code, xrun_duration_ms, xrun_stdout and xrun_error added")
+	fmt.Println("  --results-output-limit N")
+	fmt.Println("                     Keep at most N bytes of each row's stdout and stderr in --results and --annotate")
+	fmt.Println("                     (default 65536, 0 means no limit)")
+	fmt.Println("\nCSV options (for csv and tsv data, including detected delimiters):")
+	fmt.Println("  --delimiter <char> Field delimiter, e.g. ; or | (\\t or tab for tabs)")
+	fmt.Println("  --comment <char>   Skip lines starting with this character, e.g. #")
+	fmt.Println("  --no-header        The first line is a row; columns are named c1, c2, ...")
+	fmt.Println("  --columns <names>  Comma-separated column names, replacing the header line's names")
+	fmt.Println("  --lazy-quotes      Accept quotes inside unquoted fields and stray quotes in quoted fields")
+	fmt.Println("  --variable-fields  Accept rows with more or fewer fields than the header; missing fields")
+	fmt.Println("                     are left out and extra fields are named after their position (c4, ...)")
+	fmt.Println("  --trim-leading-space")
+	fmt.Println("                     Ignore white space at the start of fields")
+	fmt.Println("\nSpreadsheet options (for xlsx data):")
+	fmt.Println("  --sheet <name|N>   Worksheet to read, by name or 1-based position (default the first)")
+	fmt.Println("  --header-row N     Row holding the column names (default the first row with values)")
+	fmt.Println("  --range <cells>    Cells to read, e.g. A1:D100, or B:F for whole columns")
+	fmt.Println("\nDocument options (for json, jsonl, yaml and toml data):")
+	fmt.Println("  --root <path>      Read the rows at this path in each document instead of its top level,")
+	fmt.Println("                     e.g. data.items for {\"data\": {\"items\": [...]}}; indexes such as")
+	fmt.Println("                     results[0].rows, a leading $. or . and ['quoted.keys'] are accepted")
 	fmt.Println("\nSupported file formats:")
 	fmt.Println("  .csv       CSV files with headers")
+	fmt.Println("  .tsv       Tab-separated files with headers")
 	fmt.Println("  .json      JSON array of objects")
 	fmt.Println("  .jsonl     JSON Lines (one JSON object per line)")
-	fmt.Println("  other      Defaults to CSV parsing")
+	fmt.Println("  .xlsx      Excel workbooks; numbers and dates are converted to text such as 3.5 and 2024-01-31")
+	fmt.Println("  .yaml      YAML sequence of mappings, or one mapping per document (also .yml)")
+	fmt.Println("  .toml      TOML array of tables such as [[hosts]]")
+	fmt.Println("  other      Detected from the content: a zip archive is an XLSX workbook, [[name]] starts TOML,")
+	fmt.Println("             [ starts a JSON array, a complete object on the first line starts JSON Lines, any other")
+	fmt.Println("             { starts JSON, --- or - starts YAML, otherwise the most consistent of , tab ; | is used")
+	fmt.Println("             as the delimiter")
 	fmt.Println("\nTemplate syntax:")
 	fmt.Println("  Use {{.field_name}} to substitute values from data fields")
+	fmt.Println("  Use {{.xrun_attempt}} to substitute the current attempt number")
+	fmt.Println("  Use {{$.xrun.index}}, total, run_id, file, attempt and started_at for row and run metadata")
+	fmt.Println("  Use {{.key}} for variables set with -v or --vars, and {{env \"NAME\"}} for environment variables")
+	fmt.Println("  Use {{.user.address.city}} to reach nested JSON, YAML and TOML values, and")
+	fmt.Println("  {{range .tags}}...{{end}} to loop over arrays; objects and arrays print as JSON")
+	fmt.Println("  Use {{shq .name}} (or quote), {{json .v}}, {{urlquery .v}} or {{sqlstring .v}} to quote values")
+	fmt.Println("  Functions such as {{.name | trim | lower}} and {{add .n 1}} are listed by xrun help functions")
+	fmt.Println("\nExit status:")
+	fmt.Println("  0          All rows succeeded (or --ignore-failures was given)")
+	fmt.Println("  1          Invalid arguments or unreadable data file")
+	fmt.Println("  2          One or more rows failed, the run was aborted, or the data could not be read")
+	fmt.Println("             to the end after some rows had run")
 	fmt.Println("\nLog files:")
 	fmt.Println("  By default, execution output is saved to xrun-[data-file-name]-[timestamp].logs")
 }
\ No newline at end of file
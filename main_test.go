@@ -242,6 +242,56 @@ func TestProcessDataFileWithExecutor(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name:     "JSON with large integers",
+			fileName: "test.json",
+			fileContent: `[
+				{"id": 12345678, "big": 9007199254740993, "ratio": 1.50}
+			]`,
+			execTemplate: "echo {{.id}} {{.big}} {{.ratio}}",
+			expectedCommands: []string{
+				"echo 12345678 9007199254740993 1.50",
+			},
+			expectError: false,
+		},
+		{
+			name:     "JSON with nested values",
+			fileName: "test.json",
+			fileContent: `[
+				{"user": {"name": "Alice", "address": {"city": "Tokyo"}, "tags": ["a", "b"], "nick": null}}
+			]`,
+			execTemplate: "echo {{.user.address.city}}{{range .user.tags}} {{.}}{{end}} [{{.user.nick}}] {{.user.address}} {{.user.tags}}",
+			expectedCommands: []string{
+				`echo Tokyo a b [] {"city":"Tokyo"} ["a","b"]`,
+			},
+			expectError: false,
+		},
+		{
+			name:     "JSONL with nulls and booleans in conditions",
+			fileName: "test.jsonl",
+			fileContent: `{"name": "Alice", "admin": true, "team": null}
+{"name": "Bob", "admin": false, "team": {"id": 7}}`,
+			execTemplate: "echo {{.name}}{{if .admin}} --admin{{end}}{{if .team}} --team {{.team.id}}{{end}} {{.team}}",
+			expectedCommands: []string{
+				"echo Alice --admin ",
+				`echo Bob --team 7 {"id":7}`,
+			},
+			expectError: false,
+		},
+		{
+			name:     "YAML with nested values",
+			fileName: "test.yaml",
+			fileContent: `- host: web-1
+  port: 8080
+  owner: {team: ops}
+  aliases: [www, api]
+`,
+			execTemplate: "deploy {{.host}}:{{.port}} {{.owner.team}}{{range $i, $a := .aliases}} {{$i}}={{$a}}{{end}}",
+			expectedCommands: []string{
+				"deploy web-1:8080 ops 0=www 1=api",
+			},
+			expectError: false,
+		},
 		{
 			name:     "CSV with missing column referenced in template",
 			fileName: "test.csv",
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// OutputMode controls how the output of concurrently running commands is
+// written to the console and log file
+type OutputMode string
+
+const (
+	// OutputInterleaved writes output as soon as commands produce it
+	OutputInterleaved OutputMode = "interleaved"
+	// OutputGrouped buffers each command's output and writes it as one block when the command finishes
+	OutputGrouped OutputMode = "grouped"
+	// OutputOrdered is like OutputGrouped, but blocks are written in input row order
+	OutputOrdered OutputMode = "ordered"
+	// OutputPrefixed writes complete lines as they are produced, prefixed with the row's progress
+	OutputPrefixed OutputMode = "prefixed"
+)
+
+func parseOutputMode(s string) (OutputMode, error) {
+	switch mode := OutputMode(s); mode {
+	case OutputInterleaved, OutputGrouped, OutputOrdered, OutputPrefixed:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown output mode %q (expected interleaved, grouped, ordered or prefixed)", s)
+	}
+}
+
+type outputStream int
+
+const (
+	streamStdout outputStream = iota
+	streamStderr
+)
+
+type outputSegment struct {
+	stream outputStream
+	data   []byte
+}
+
+// outputCoordinator hands out per-job writers and decides when their output
+// reaches the console and log file
+type outputCoordinator struct {
+	mode   OutputMode
+	stdout io.Writer
+	stderr io.Writer
+	log    *LogWriter
+	// capture, when set, returns writers that additionally receive the
+	// output of each attempt
+	capture func(progress Progress) (io.Writer, io.Writer)
+
+	mu sync.Mutex
+	// rows, next and finished track ordered mode: rows holds the output of
+	// rows still running (across retries), finished holds rows (nil when
+	// nothing ran) that completed before the row numbered next
+	rows     map[int]*jobOutput
+	next     int
+	finished map[int]*jobOutput
+}
+
+func newOutputCoordinator(mode OutputMode, logWriter *LogWriter) *outputCoordinator {
+	if mode == "" {
+		mode = OutputInterleaved
+	}
+	return &outputCoordinator{
+		mode:     mode,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		log:      logWriter,
+		rows:     make(map[int]*jobOutput),
+		next:     1,
+		finished: make(map[int]*jobOutput),
+	}
+}
+
+// write sends data to the console stream and the log file. Callers must hold o.mu.
+func (o *outputCoordinator) write(stream outputStream, data []byte) {
+	if stream == streamStderr {
+		o.stderr.Write(data)
+	} else {
+		o.stdout.Write(data)
+	}
+	if o.log != nil {
+		o.log.Write(data)
+	}
+}
+
+// begin returns the output for the command at progress. The caller must call
+// finish on it once the command has exited. In ordered mode every attempt of
+// a row shares one output, which is held until done is called for the row.
+func (o *outputCoordinator) begin(progress Progress) *jobOutput {
+	var captureStdout, captureStderr io.Writer
+	if o.capture != nil {
+		captureStdout, captureStderr = o.capture(progress)
+	}
+
+	if o.mode == OutputOrdered {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if job, ok := o.rows[progress.Current]; ok {
+			job.setCapture(captureStdout, captureStderr)
+			return job
+		}
+	}
+
+	job := &jobOutput{coordinator: o, progress: progress}
+	job.Stdout = &jobStreamWriter{job: job, stream: streamStdout}
+	job.Stderr = &jobStreamWriter{job: job, stream: streamStderr}
+	job.setCapture(captureStdout, captureStderr)
+	if o.mode == OutputOrdered {
+		o.rows[progress.Current] = job
+	}
+	return job
+}
+
+// done marks the row numbered current as finished, whether or not it ran
+func (o *outputCoordinator) done(current int) {
+	if o.mode != OutputOrdered {
+		return
+	}
+	o.mu.Lock()
+	job := o.rows[current]
+	delete(o.rows, current)
+	o.mu.Unlock()
+	o.complete(current, job)
+}
+
+// complete records a finished row and flushes every row that is now next in order
+func (o *outputCoordinator) complete(current int, job *jobOutput) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.finished[current] = job
+	for {
+		job, ok := o.finished[o.next]
+		if !ok {
+			break
+		}
+		delete(o.finished, o.next)
+		if job != nil {
+			job.flush()
+		}
+		o.next++
+	}
+}
+
+// jobOutput collects the output of a single command
+type jobOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+
+	coordinator *outputCoordinator
+	progress    Progress
+
+	mu       sync.Mutex
+	segments []outputSegment
+	partial  [2][]byte
+	captures [2]io.Writer
+}
+
+type jobStreamWriter struct {
+	job    *jobOutput
+	stream outputStream
+}
+
+func (w *jobStreamWriter) Write(p []byte) (int, error) {
+	w.job.mu.Lock()
+	capture := w.job.captures[w.stream]
+	w.job.mu.Unlock()
+	if capture != nil {
+		capture.Write(p)
+	}
+
+	w.job.write(w.stream, p)
+	return len(p), nil
+}
+
+// setCapture replaces the writers that additionally receive the job's output
+func (j *jobOutput) setCapture(stdout, stderr io.Writer) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.captures = [2]io.Writer{stdout, stderr}
+}
+
+func (j *jobOutput) prefix() string {
+	return j.progress.String() + " "
+}
+
+func (j *jobOutput) write(stream outputStream, p []byte) {
+	o := j.coordinator
+	switch o.mode {
+	case OutputInterleaved:
+		o.mu.Lock()
+		o.write(stream, p)
+		o.mu.Unlock()
+	case OutputPrefixed:
+		j.mu.Lock()
+		buf := append(j.partial[stream], p...)
+		var lines [][]byte
+		for {
+			i := bytes.IndexByte(buf, '\n')
+			if i < 0 {
+				break
+			}
+			lines = append(lines, buf[:i+1])
+			buf = buf[i+1:]
+		}
+		j.partial[stream] = append([]byte(nil), buf...)
+		j.mu.Unlock()
+
+		o.mu.Lock()
+		for _, line := range lines {
+			o.write(stream, append([]byte(j.prefix()), line...))
+		}
+		o.mu.Unlock()
+	default:
+		j.mu.Lock()
+		if n := len(j.segments); n > 0 && j.segments[n-1].stream == stream {
+			j.segments[n-1].data = append(j.segments[n-1].data, p...)
+		} else {
+			j.segments = append(j.segments, outputSegment{stream: stream, data: append([]byte(nil), p...)})
+		}
+		j.mu.Unlock()
+	}
+}
+
+// announce writes a status line for the job. In prefixed mode the line is
+// written as is, since it already carries the row's progress.
+func (j *jobOutput) announce(line string) {
+	data := []byte(line + "\n")
+	if j.coordinator.mode == OutputPrefixed {
+		j.coordinator.mu.Lock()
+		j.coordinator.write(streamStdout, data)
+		j.coordinator.mu.Unlock()
+		return
+	}
+	j.write(streamStdout, data)
+}
+
+// finish writes any output still held for the job, except in ordered mode
+// where the output is written once the row is done
+func (j *jobOutput) finish() {
+	o := j.coordinator
+	switch o.mode {
+	case OutputPrefixed:
+		j.mu.Lock()
+		partial := j.partial
+		j.partial = [2][]byte{}
+		j.mu.Unlock()
+
+		o.mu.Lock()
+		for stream, data := range partial {
+			if len(data) > 0 {
+				o.write(outputStream(stream), append(append([]byte(j.prefix()), data...), '\n'))
+			}
+		}
+		o.mu.Unlock()
+	case OutputGrouped:
+		o.mu.Lock()
+		j.flush()
+		o.mu.Unlock()
+	}
+}
+
+// flush writes the buffered segments. Callers must hold the coordinator's mu.
+func (j *jobOutput) flush() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, segment := range j.segments {
+		j.coordinator.write(segment.stream, segment.data)
+	}
+	j.segments = nil
+}
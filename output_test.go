@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func newTestOutputCoordinator(mode OutputMode) (*outputCoordinator, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	o := newOutputCoordinator(mode, nil)
+	o.stdout = &stdout
+	o.stderr = &stderr
+	return o, &stdout, &stderr
+}
+
+func TestParseOutputMode(t *testing.T) {
+	for _, mode := range []string{"interleaved", "grouped", "ordered", "prefixed"} {
+		if _, err := parseOutputMode(mode); err != nil {
+			t.Errorf("parseOutputMode(%q) returned error: %v", mode, err)
+		}
+	}
+	if _, err := parseOutputMode("random"); err == nil {
+		t.Error("Expected error for unknown output mode")
+	}
+}
+
+func TestOutputCoordinator(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           OutputMode
+		run            func(o *outputCoordinator)
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name: "interleaved writes immediately",
+			mode: OutputInterleaved,
+			run: func(o *outputCoordinator) {
+				a := o.begin(Progress{Current: 1, Total: 2})
+				b := o.begin(Progress{Current: 2, Total: 2})
+				fmt.Fprint(a.Stdout, "a1\n")
+				fmt.Fprint(b.Stdout, "b1\n")
+				fmt.Fprint(a.Stdout, "a2\n")
+				a.finish()
+				b.finish()
+			},
+			expectedStdout: "a1\nb1\na2\n",
+		},
+		{
+			name: "grouped writes each job as a block",
+			mode: OutputGrouped,
+			run: func(o *outputCoordinator) {
+				a := o.begin(Progress{Current: 1, Total: 2})
+				b := o.begin(Progress{Current: 2, Total: 2})
+				fmt.Fprint(a.Stdout, "a1\n")
+				fmt.Fprint(b.Stdout, "b1\n")
+				fmt.Fprint(a.Stderr, "a-err\n")
+				fmt.Fprint(b.Stdout, "b2\n")
+				fmt.Fprint(a.Stdout, "a2\n")
+				b.finish()
+				a.finish()
+			},
+			expectedStdout: "b1\nb2\na1\na2\n",
+			expectedStderr: "a-err\n",
+		},
+		{
+			name: "ordered follows row order across retries and skipped rows",
+			mode: OutputOrdered,
+			run: func(o *outputCoordinator) {
+				a := o.begin(Progress{Current: 1, Total: 4})
+				c := o.begin(Progress{Current: 3, Total: 4})
+				d := o.begin(Progress{Current: 4, Total: 4})
+				fmt.Fprint(d.Stdout, "d\n")
+				d.finish()
+				o.done(4)
+				fmt.Fprint(c.Stdout, "c1\n")
+				c.finish()
+				retry := o.begin(Progress{Current: 3, Total: 4, Attempt: 2})
+				fmt.Fprint(retry.Stdout, "c2\n")
+				retry.finish()
+				o.done(3)
+				fmt.Fprint(a.Stdout, "a\n")
+				a.finish()
+				o.done(1)
+				o.done(2)
+			},
+			expectedStdout: "a\nc1\nc2\nd\n",
+		},
+		{
+			name: "prefixed tags complete lines",
+			mode: OutputPrefixed,
+			run: func(o *outputCoordinator) {
+				a := o.begin(Progress{Current: 17, Total: 200})
+				a.announce("[17/200] Executing: echo")
+				fmt.Fprint(a.Stdout, "hel")
+				fmt.Fprint(a.Stdout, "lo\nworld")
+				fmt.Fprint(a.Stderr, "oops\n")
+				a.finish()
+			},
+			expectedStdout: "[17/200] Executing: echo\n[17/200] hello\n[17/200] world\n",
+			expectedStderr: "[17/200] oops\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, stdout, stderr := newTestOutputCoordinator(tt.mode)
+			tt.run(o)
+
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("Expected stdout %q, got %q", tt.expectedStdout, stdout.String())
+			}
+			if stderr.String() != tt.expectedStderr {
+				t.Errorf("Expected stderr %q, got %q", tt.expectedStderr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunnerParallelExecution(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	var csvContent strings.Builder
+	csvContent.WriteString("id\n")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(&csvContent, "%d\n", i)
+	}
+	if _, err := tmpFile.WriteString(csvContent.String()); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	var mu sync.Mutex
+	var executedCommands []string
+	var progresses []Progress
+	var running, maxRunning int32
+
+	mockExecutor := func(command string, progress Progress) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		mu.Lock()
+		executedCommands = append(executedCommands, command)
+		progresses = append(progresses, progress)
+		mu.Unlock()
+		return nil
+	}
+
+	err = processDataFileWithRunner(tmpFile.Name(), "echo {{.id}}", newRunner(mockExecutor, 4))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(executedCommands) != 8 {
+		t.Fatalf("Expected 8 commands, got %d", len(executedCommands))
+	}
+	if maxRunning < 2 {
+		t.Errorf("Expected commands to run concurrently, max concurrency was %d", maxRunning)
+	}
+	if maxRunning > 4 {
+		t.Errorf("Expected at most 4 concurrent commands, got %d", maxRunning)
+	}
+
+	sort.Slice(progresses, func(i, j int) bool { return progresses[i].Current < progresses[j].Current })
+	for i, progress := range progresses {
+		if progress.Current != i+1 || progress.Total != 8 {
+			t.Errorf("Progress %d: expected {%d 8}, got %+v", i, i+1, progress)
+		}
+	}
+}
+
+func TestLogWriterConcurrentWrites(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_*.logs")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	logWriter := &LogWriter{file: tmpFile}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fmt.Fprintf(logWriter, "line %d\n", i)
+		}(i)
+	}
+	wg.Wait()
+	logWriter.Close()
+
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 50 {
+		t.Errorf("Expected 50 log lines, got %d", len(lines))
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setProcessGroup only bounds how long a cancelled command is waited for on
+// platforms without process groups; the command itself is killed on cancellation.
+// The returned function, to call once cmd.Wait has returned, does nothing.
+func setProcessGroup(cmd *exec.Cmd, grace time.Duration) (release func()) {
+	cmd.WaitDelay = grace
+	return func() {}
+}
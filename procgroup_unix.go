@@ -0,0 +1,45 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup runs cmd in its own process group. When the command's
+// context is cancelled the whole group receives SIGTERM, followed by SIGKILL
+// once grace has elapsed, so that children spawned by the shell do not leak.
+//
+// The returned function must be called once cmd.Wait has returned. It stops
+// the pending SIGKILL, which could otherwise reach an unrelated group that
+// has reused the ID of a group that exited on SIGTERM, and kills any members
+// of the group still running at once instead.
+func setProcessGroup(cmd *exec.Cmd, grace time.Duration) (release func()) {
+	var mu sync.Mutex
+	var kill *time.Timer
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		mu.Lock()
+		kill = time.AfterFunc(grace, func() {
+			syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		mu.Unlock()
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+	// Stop waiting for output from stragglers that survived the SIGKILL
+	cmd.WaitDelay = grace + time.Second
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		// The group's ID cannot be reused while it has members, so it still
+		// names this group if the kill is sent right after the leader exited
+		if kill != nil && kill.Stop() {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		kill = nil
+	}
+}
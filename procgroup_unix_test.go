@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestPrepareCommandProcessGroup(t *testing.T) {
+	for _, isolate := range []bool{false, true} {
+		cmd := exec.CommandContext(context.Background(), "sleep", "10")
+		release := prepareCommand(cmd, isolate)
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start command: %v", err)
+		}
+		pgid, err := syscall.Getpgid(cmd.Process.Pid)
+		cmd.Process.Kill()
+		cmd.Wait()
+		release()
+		if err != nil {
+			t.Fatalf("Failed to get process group: %v", err)
+		}
+
+		// Only isolated commands leave xrun's group, which the terminal
+		// lets read its input and sends Ctrl-C to
+		if own := pgid != syscall.Getpgrp(); own != isolate {
+			t.Errorf("isolate=%t: expected own process group %t, got %t", isolate, isolate, own)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultResultsOutputLimit is how many bytes of each stream are kept per row
+// in the results and annotate files unless --results-output-limit says otherwise
+const defaultResultsOutputLimit = 64 * 1024
+
+// commandResult describes how a row's command ran, across all its attempts
+type commandResult struct {
+	command  string
+	attempts int
+	started  time.Time
+	ended    time.Time
+	err      error
+}
+
+// rowReport is everything known about a finished row
+type rowReport struct {
+	job    rowJob
+	status RowStatus
+	// result is nil when the row's command never ran
+	result *commandResult
+	// output is nil when the row's output was not captured
+	output *rowCapture
+}
+
+// resultRecord is one line of a results file
+type resultRecord struct {
+	Row             int            `json:"row"`
+	Input           map[string]any `json:"input"`
+	Command         string         `json:"command,omitempty"`
+	Status          string         `json:"status"`
+	StartedAt       string         `json:"started_at,omitempty"`
+	EndedAt         string         `json:"ended_at,omitempty"`
+	DurationMs      int64          `json:"duration_ms"`
+	ExitCode        *int           `json:"exit_code"`
+	Signal          string         `json:"signal,omitempty"`
+	Attempts        int            `json:"attempts"`
+	Stdout          string         `json:"stdout"`
+	Stderr          string         `json:"stderr"`
+	StdoutTruncated bool           `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool           `json:"stderr_truncated,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// resultsWriter writes one JSON Lines record per finished row, including the
+// output its command produced. It is safe for concurrent use.
+type resultsWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newResultsWriter(path string) (*resultsWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &resultsWriter{file: file}, nil
+}
+
+// write appends the record for a finished row
+func (w *resultsWriter) write(report rowReport) error {
+	record := resultRecord{
+		Row:    report.job.progress.Current,
+		Input:  report.job.row.Values,
+		Status: report.status.String(),
+	}
+	if result := report.result; result != nil {
+		record.Command = result.command
+		record.StartedAt = result.started.Format(time.RFC3339Nano)
+		record.EndedAt = result.ended.Format(time.RFC3339Nano)
+		record.DurationMs = result.duration().Milliseconds()
+		record.Attempts = result.attempts
+		record.ExitCode, record.Signal = exitStatus(result.err)
+		if result.err != nil {
+			record.Error = result.err.Error()
+		}
+	}
+	if report.output != nil {
+		record.Stdout, record.StdoutTruncated = report.output.stdout.contents()
+		record.Stderr, record.StderrTruncated = report.output.stderr.contents()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.file.Write(append(data, '\n'))
+	return err
+}
+
+func (w *resultsWriter) Close() error {
+	return w.file.Close()
+}
+
+// exitStatus extracts the exit code, or the signal that killed the command,
+// from the error returned by running it. The exit code is nil when the
+// command did not exit normally.
+func exitStatus(err error) (*int, string) {
+	if err == nil {
+		code := 0
+		return &code, ""
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, ""
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return nil, status.Signal().String()
+	}
+	code := exitErr.ExitCode()
+	return &code, ""
+}
+
+// duration is the time from the start of the first attempt to the end of the last
+func (r *commandResult) duration() time.Duration {
+	return r.ended.Sub(r.started)
+}
+
+// outputCaptures collects the output of every row's command, for the results
+// and annotate files. It is safe for concurrent use.
+type outputCaptures struct {
+	mu sync.Mutex
+	// limit is the number of bytes kept per stream (0 means no limit)
+	limit int
+	rows  map[int]*rowCapture
+}
+
+func newOutputCaptures(limit int) *outputCaptures {
+	return &outputCaptures{limit: limit, rows: make(map[int]*rowCapture)}
+}
+
+// capture returns writers collecting the output of the command at progress.
+// Every attempt starts with empty buffers, so only the output of the last
+// attempt is kept.
+func (c *outputCaptures) capture(progress Progress) (io.Writer, io.Writer) {
+	row := &rowCapture{
+		stdout: &limitedBuffer{limit: c.limit},
+		stderr: &limitedBuffer{limit: c.limit},
+	}
+	c.mu.Lock()
+	c.rows[progress.Current] = row
+	c.mu.Unlock()
+	return row.stdout, row.stderr
+}
+
+// take removes and returns the output captured for row, if any
+func (c *outputCaptures) take(row int) *rowCapture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	output := c.rows[row]
+	delete(c.rows, row)
+	return output
+}
+
+// rowCapture holds the output of a row's latest attempt
+type rowCapture struct {
+	stdout *limitedBuffer
+	stderr *limitedBuffer
+}
+
+// limitedBuffer keeps the first limit bytes written to it (all of them when
+// limit is 0) and remembers whether anything was dropped
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := p
+	if b.limit > 0 {
+		if remaining := b.limit - b.buf.Len(); len(data) > remaining {
+			data = data[:max(remaining, 0)]
+			b.truncated = true
+		}
+	}
+	b.buf.Write(data)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) contents() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String(), b.truncated
+}
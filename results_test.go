@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name              string
+		limit             int
+		writes            []string
+		expected          string
+		expectedTruncated bool
+	}{
+		{name: "no limit", limit: 0, writes: []string{"hello ", "world"}, expected: "hello world"},
+		{name: "within limit", limit: 11, writes: []string{"hello ", "world"}, expected: "hello world"},
+		{name: "truncated mid write", limit: 8, writes: []string{"hello ", "world"}, expected: "hello wo", expectedTruncated: true},
+		{name: "writes after limit", limit: 5, writes: []string{"hello", " ", "world"}, expected: "hello", expectedTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tt.limit}
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			contents, truncated := b.contents()
+			if contents != tt.expected || truncated != tt.expectedTruncated {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.expected, tt.expectedTruncated, contents, truncated)
+			}
+		})
+	}
+}
+
+func readResults(t *testing.T, path string) map[int]resultRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open results file: %v", err)
+	}
+	defer file.Close()
+
+	records := make(map[int]resultRecord)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record resultRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid results line %q: %v", scanner.Text(), err)
+		}
+		records[record.Row] = record
+	}
+	return records
+}
+
+func TestProcessDataFileResults(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.csv")
+	csvContent := `name,script
+ok,echo out; echo err >&2
+fail,echo partial; exit 3
+killed,kill -TERM $$
+chatty,printf 0123456789
+`
+	if err := os.WriteFile(dataFile, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	resultsFile := filepath.Join(dir, "results.jsonl")
+	config := Config{
+		DataFile:           dataFile,
+		Template:           "{{.script}}",
+		NoLogFiles:         true,
+		IgnoreFailures:     true,
+		RetryPolicy:        RetryPolicy{Retries: 1, OnExitCodes: map[int]bool{3: true}},
+		ResultsFile:        resultsFile,
+		ResultsOutputLimit: 4,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	records := readResults(t, resultsFile)
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d: %v", len(records), records)
+	}
+
+	ok := records[1]
+	if ok.Status != "succeeded" || ok.ExitCode == nil || *ok.ExitCode != 0 || ok.Attempts != 1 {
+		t.Errorf("Unexpected record for succeeding row: %+v", ok)
+	}
+	if ok.Command != "echo out; echo err >&2" || ok.Input["name"] != "ok" {
+		t.Errorf("Expected command and input of row 1, got %q and %v", ok.Command, ok.Input)
+	}
+	if ok.Stdout != "out\n" || ok.Stderr != "err\n" {
+		t.Errorf("Expected captured output, got stdout %q, stderr %q", ok.Stdout, ok.Stderr)
+	}
+	if ok.StartedAt == "" || ok.EndedAt == "" || ok.DurationMs < 0 {
+		t.Errorf("Expected timestamps and duration, got %+v", ok)
+	}
+
+	fail := records[2]
+	if fail.Status != "failed" || fail.ExitCode == nil || *fail.ExitCode != 3 || fail.Attempts != 2 {
+		t.Errorf("Unexpected record for failing row: %+v", fail)
+	}
+	if !strings.Contains(fail.Error, "exit status 3") {
+		t.Errorf("Expected exit status in error, got %q", fail.Error)
+	}
+	if fail.Stdout != "part" || !fail.StdoutTruncated {
+		t.Errorf("Expected truncated output of the last attempt, got %q (truncated=%v)", fail.Stdout, fail.StdoutTruncated)
+	}
+
+	killed := records[3]
+	if killed.ExitCode != nil || killed.Signal != "terminated" {
+		t.Errorf("Expected row killed by signal, got exit code %v, signal %q", killed.ExitCode, killed.Signal)
+	}
+
+	chatty := records[4]
+	if chatty.Stdout != "0123" || !chatty.StdoutTruncated {
+		t.Errorf("Expected truncated stdout, got %q (truncated=%v)", chatty.Stdout, chatty.StdoutTruncated)
+	}
+}
+
+func TestProcessDataFileResultsTemplateError(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.jsonl")
+	if err := os.WriteFile(dataFile, []byte(`{"n": 1}`+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	resultsFile := filepath.Join(dir, "results.jsonl")
+	config := Config{
+		DataFile:       dataFile,
+		Template:       `{{index .n 5}}`,
+		NoLogFiles:     true,
+		IgnoreFailures: true,
+		ResultsFile:    resultsFile,
+	}
+	if err := processDataFile(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	record, ok := readResults(t, resultsFile)[1]
+	if !ok {
+		t.Fatal("Expected a record for row 1")
+	}
+	if record.Status != "template_error" || record.Command != "" || record.ExitCode != nil || record.Attempts != 0 {
+		t.Errorf("Unexpected record for template error row: %+v", record)
+	}
+}
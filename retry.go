@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryDelay caps the exponential backoff between retries
+const maxRetryDelay = time.Minute
+
+// RetryPolicy decides whether and when a failed command is retried. The zero
+// value never retries.
+type RetryPolicy struct {
+	// Retries is the number of times a failed command is retried
+	Retries int
+	// Delay is the backoff before the first retry, doubled on every further retry
+	Delay time.Duration
+	// MaxDelay caps the backoff (0 means no cap)
+	MaxDelay time.Duration
+	// OnExitCodes restricts retries to commands exiting with one of these codes
+	// (nil means any failure is retried)
+	OnExitCodes map[int]bool
+}
+
+// shouldRetry reports whether a command failing with err on attempt should be run again
+func (p RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if attempt > p.Retries {
+		return false
+	}
+	if p.OnExitCodes == nil {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return p.OnExitCodes[exitErr.ExitCode()]
+}
+
+// backoff returns the delay before the attempt following attempt. The delay
+// doubles on every attempt and is jittered to between half and all of it, so
+// that parallel jobs do not retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// parseExitCodes parses a comma-separated list of exit codes such as "7,28,56"
+func parseExitCodes(s string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit code %q", part)
+		}
+		codes[code] = true
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no exit codes given")
+	}
+	return codes, nil
+}
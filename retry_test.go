@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseExitCodes(t *testing.T) {
+	codes, err := parseExitCodes("7, 28,56")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, code := range []int{7, 28, 56} {
+		if !codes[code] {
+			t.Errorf("Expected exit code %d to be included", code)
+		}
+	}
+	if len(codes) != 3 {
+		t.Errorf("Expected 3 exit codes, got %d", len(codes))
+	}
+
+	if _, err := parseExitCodes("7,x"); err == nil {
+		t.Error("Expected error for invalid exit code")
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	exitErr := exec.Command("bash", "-c", "exit 28").Run()
+	otherExitErr := exec.Command("bash", "-c", "exit 1").Run()
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		err      error
+		expected bool
+	}{
+		{name: "no retries", policy: RetryPolicy{}, attempt: 1, err: exitErr, expected: false},
+		{name: "retries left", policy: RetryPolicy{Retries: 2}, attempt: 2, err: exitErr, expected: true},
+		{name: "retries exhausted", policy: RetryPolicy{Retries: 2}, attempt: 3, err: exitErr, expected: false},
+		{name: "matching exit code", policy: RetryPolicy{Retries: 1, OnExitCodes: map[int]bool{28: true}}, attempt: 1, err: exitErr, expected: true},
+		{name: "other exit code", policy: RetryPolicy{Retries: 1, OnExitCodes: map[int]bool{28: true}}, attempt: 1, err: otherExitErr, expected: false},
+		{name: "non exit error with filter", policy: RetryPolicy{Retries: 1, OnExitCodes: map[int]bool{28: true}}, attempt: 1, err: errors.New("empty command"), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.shouldRetry(tt.attempt, tt.err); got != tt.expected {
+				t.Errorf("Expected shouldRetry=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{Delay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 5, min: 150 * time.Millisecond, max: 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(tt.attempt)
+			if delay < tt.min || delay > tt.max {
+				t.Errorf("Attempt %d: expected delay between %s and %s, got %s", tt.attempt, tt.min, tt.max, delay)
+			}
+		}
+	}
+}
+
+func TestRunnerRetries(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	csvContent := `id
+1
+2`
+	if _, err := tmpFile.WriteString(csvContent); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	var executedCommands []string
+	mockExecutor := func(ctx context.Context, command string, progress Progress) error {
+		executedCommands = append(executedCommands, command)
+		// Row 1 succeeds on its second attempt, row 2 never succeeds
+		if progress.Current == 1 && progress.Attempt == 2 {
+			return nil
+		}
+		return errors.New("transient failure")
+	}
+
+	r := newContextRunner(mockExecutor, 1)
+	r.retry = RetryPolicy{Retries: 2, Delay: time.Millisecond}
+	if err := processDataFileWithRunner(tmpFile.Name(), "echo {{.id}} attempt {{.xrun_attempt}}", r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedCommands := []string{
+		"echo 1 attempt 1",
+		"echo 1 attempt 2",
+		"echo 2 attempt 1",
+		"echo 2 attempt 2",
+		"echo 2 attempt 3",
+	}
+	if len(executedCommands) != len(expectedCommands) {
+		t.Fatalf("Expected %d commands, got %d: %v", len(expectedCommands), len(executedCommands), executedCommands)
+	}
+	for i, expected := range expectedCommands {
+		if executedCommands[i] != expected {
+			t.Errorf("Command %d: expected %q, got %q", i, expected, executedCommands[i])
+		}
+	}
+	if r.summary.FailureCount() != 1 {
+		t.Errorf("Expected 1 failed row, got %d", r.summary.FailureCount())
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rowPath leads from the top of a document to its rows, such as data.items
+// for {"data": {"items": [...]}}. An empty path is the document itself.
+type rowPath []pathStep
+
+// pathStep is an object key, or an array index when isIndex is set
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// plainKey matches keys that need no quotes in a path
+var plainKey = regexp.MustCompile(`^[^.\[\]"']+$`)
+
+// parseRowPath parses a path made of keys separated by dots and array
+// indexes in brackets, e.g. data.items or results[0].rows. A leading $ or .
+// and a trailing [] are accepted as in JSONPath and jq, and keys containing
+// dots can be quoted as in ["app.name"].
+func parseRowPath(s string) (rowPath, error) {
+	text := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "$"), "[]")
+	invalid := func(reason string) (rowPath, error) {
+		return nil, fmt.Errorf("invalid root path %q: %s", s, reason)
+	}
+
+	var path rowPath
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == '[' && i+1 < len(text) && (text[i+1] == '"' || text[i+1] == '\''):
+			// Quoted keys may contain dots and brackets, so look for the
+			// closing quote before the ]
+			start := i + 2
+			closing := strings.IndexByte(text[start:], text[i+1])
+			if closing < 0 || !strings.HasPrefix(text[start+closing+1:], "]") {
+				return invalid("unterminated quoted key")
+			}
+			path = append(path, pathStep{key: text[start : start+closing]})
+			i = start + closing + 2
+		case text[i] == '[':
+			end := strings.IndexByte(text[i:], ']')
+			if end < 0 {
+				return invalid("missing ]")
+			}
+			inner := text[i+1 : i+end]
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return invalid(fmt.Sprintf("%q is not an array index", inner))
+			}
+			path = append(path, pathStep{index: index, isIndex: true})
+			i += end + 1
+		case text[i] == '.' || i == 0:
+			if text[i] == '.' {
+				i++
+			}
+			end := i
+			for end < len(text) && text[end] != '.' && text[end] != '[' {
+				end++
+			}
+			if end == i {
+				if end == len(text) && len(path) == 0 {
+					// "." alone is the whole document
+					break
+				}
+				return invalid("empty key")
+			}
+			path = append(path, pathStep{key: text[i:end]})
+			i = end
+		default:
+			return invalid(fmt.Sprintf("unexpected %q", text[i]))
+		}
+	}
+	return path, nil
+}
+
+func (p rowPath) String() string {
+	var b strings.Builder
+	for _, step := range p {
+		switch {
+		case step.isIndex:
+			fmt.Fprintf(&b, "[%d]", step.index)
+		case plainKey.MatchString(step.key):
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(step.key)
+		default:
+			fmt.Fprintf(&b, "[%q]", step.key)
+		}
+	}
+	return b.String()
+}
+
+// keys returns the path's keys, if it has no array indexes
+func (p rowPath) keys() ([]string, bool) {
+	keys := make([]string, 0, len(p))
+	for _, step := range p {
+		if step.isIndex {
+			return nil, false
+		}
+		keys = append(keys, step.key)
+	}
+	return keys, true
+}
+
+// lookup follows the path through values decoded from JSON
+func (p rowPath) lookup(v any) (any, bool) {
+	for _, step := range p {
+		if step.isIndex {
+			list, ok := v.([]any)
+			if !ok || step.index >= len(list) {
+				return nil, false
+			}
+			v = list[step.index]
+			continue
+		}
+		object, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = object[step.key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// applyRoot returns format reading the rows found at path inside each
+// document. Only formats holding nested documents support a root.
+func applyRoot(format *Format, path rowPath) (*Format, error) {
+	if len(path) == 0 {
+		return format, nil
+	}
+	if format.root == nil {
+		return nil, fmt.Errorf("--root cannot be used with %s data", format.Name)
+	}
+	return format.root(path), nil
+}
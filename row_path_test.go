@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRowPath(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		steps       int
+		expectError bool
+	}{
+		{input: "data.items", expected: "data.items", steps: 2},
+		{input: "$.data.items", expected: "data.items", steps: 2},
+		{input: ".data.items[]", expected: "data.items", steps: 2},
+		{input: "results[0].rows", expected: "results[0].rows", steps: 3},
+		{input: "[2]", expected: "[2]", steps: 1},
+		{input: `data["app.name"]`, expected: `data["app.name"]`, steps: 2},
+		{input: "data['a]b'].x", expected: `data["a]b"].x`, steps: 3},
+		{input: "$", expected: "", steps: 0},
+		{input: ".", expected: "", steps: 0},
+		{input: "", expected: "", steps: 0},
+		{input: "data..items", expectError: true},
+		{input: "data.", expectError: true},
+		{input: "data[x]", expectError: true},
+		{input: "data[-1]", expectError: true},
+		{input: "data[0", expectError: true},
+		{input: `data["x]`, expectError: true},
+		{input: "data[0]x", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			path, err := parseRowPath(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error, got %v", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if path.String() != tt.expected || len(path) != tt.steps {
+				t.Errorf("Expected %q with %d steps, got %q with %d", tt.expected, tt.steps, path.String(), len(path))
+			}
+		})
+	}
+}
+
+func TestRootRows(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		root        string
+		content     string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "json nested array",
+			format:   "json",
+			root:     "data.items",
+			content:  `{"meta": {"items": [{"x": 0}]}, "data": {"total": 2, "items": [{"id": 1}, {"id": 2}]}, "after": [1]}`,
+			expected: []string{"1 map[id:1]", "2 map[id:2]"},
+		},
+		{
+			name:     "json array index",
+			format:   "json",
+			root:     "$.pages[1].items",
+			content:  `{"pages": [{"items": [{"id": 1}]}, {"items": [{"id": 2}, "x"]}]}`,
+			expected: []string{"1 map[id:2]", "2 error"},
+		},
+		{
+			name:        "json root not found",
+			format:      "json",
+			root:        "data.rows",
+			content:     `{"data": {"items": []}}`,
+			expectError: true,
+		},
+		{
+			name:        "json root not an array",
+			format:      "json",
+			root:        "data",
+			content:     `{"data": {"items": []}}`,
+			expectError: true,
+		},
+		{
+			name:     "jsonl array in each line",
+			format:   "jsonl",
+			root:     "data.items",
+			content:  "{\"data\": {\"items\": [{\"id\": 1}, {\"id\": 2}]}}\n\n{\"data\": {\"items\": []}}\n{\"data\": {\"items\": [{\"id\": 3}]}}\n",
+			expected: []string{"1 map[id:1]", "2 map[id:2]", "3 map[id:3]"},
+		},
+		{
+			name:     "jsonl object in each line",
+			format:   "jsonl",
+			root:     "event",
+			content:  "{\"event\": {\"id\": 1}}\n{\"other\": 1}\n{\"event\": 5}\nnot json\n{\"event\": {\"id\": 4}}\n",
+			expected: []string{"1 map[id:1]", "2 error", "3 error", "4 error", "5 map[id:4]"},
+		},
+		{
+			name:     "yaml documents",
+			format:   "yaml",
+			root:     "spec.hosts",
+			content:  "spec:\n  hosts:\n    - name: a\n    - name: b\n---\nspec: {}\n---\nspec:\n  hosts:\n    name: c\n",
+			expected: []string{"1 map[name:a]", "2 map[name:b]", "3 error", "4 map[name:c]"},
+		},
+		{
+			name:     "toml nested array of tables",
+			format:   "toml",
+			root:     "servers.prod",
+			content:  "[[servers.prod]]\nname = \"a\"\n[[servers.prod]]\nname = \"b\"\n[[servers.dev]]\nname = \"c\"\n",
+			expected: []string{"1 map[name:a]", "2 map[name:b]"},
+		},
+		{
+			name:     "toml chooses between arrays of tables",
+			format:   "toml",
+			root:     "services",
+			content:  "[[hosts]]\nname = \"a\"\n[[services]]\nname = \"b\"\n",
+			expected: []string{"1 map[name:b]"},
+		},
+		{
+			name:        "toml root not an array of tables",
+			format:      "toml",
+			root:        "title",
+			content:     "title = \"x\"\n[[hosts]]\nname = \"a\"\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseRowPath(tt.root)
+			if err != nil {
+				t.Fatalf("Failed to parse root: %v", err)
+			}
+			format, err := applyRoot(formats[tt.format], root)
+			if err != nil {
+				t.Fatalf("Failed to apply root: %v", err)
+			}
+
+			rows, err := readAllRows(t, format, tt.content)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, row := range rows {
+				if row.Err != nil {
+					got = append(got, fmt.Sprintf("%d error", row.Index))
+				} else {
+					got = append(got, fmt.Sprintf("%d %v", row.Index, row.Values))
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected rows\n%q\ngot\n%q", tt.expected, got)
+			}
+
+			count, err := format.Count(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Failed to count rows: %v", err)
+			}
+			if count != len(rows) {
+				t.Errorf("Expected %d rows to be counted, got %d", len(rows), count)
+			}
+		})
+	}
+}
+
+func TestApplyRootFlatFormat(t *testing.T) {
+	root, _ := parseRowPath("data.items")
+	for _, name := range []string{"csv", "tsv", "xlsx"} {
+		if _, err := applyRoot(formats[name], root); err == nil {
+			t.Errorf("Expected --root to be rejected for %s data", name)
+		}
+	}
+	if format, err := applyRoot(formats["csv"], nil); err != nil || format != formats["csv"] {
+		t.Errorf("Expected an empty root to leave the format unchanged, got %v, %v", format, err)
+	}
+}
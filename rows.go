@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+)
+
+// rowTotal is the number of rows in a data file. When streaming it is counted
+// in the background while rows are already running, and is 0 until known.
+type rowTotal struct {
+	n atomic.Int64
+}
+
+func (t *rowTotal) get() int {
+	return int(t.n.Load())
+}
+
+// countRows counts the rows of dataFile, read from encoding, in a separate
+// pass over the file, which does not hold rows in memory. Unless stream is set, it returns once
+// the rows have been counted. A file that cannot be counted leaves the total
+// unknown; reading its rows reports the problem.
+func countRows(dataFile, encoding string, count func(io.Reader) (int, error), stream bool) *rowTotal {
+	total := &rowTotal{}
+	run := func() {
+		file, err := os.Open(dataFile)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		if n, err := count(bufio.NewReader(newDecodingReader(file, encoding))); err == nil {
+			total.n.Store(int64(n))
+		}
+	}
+
+	if stream {
+		go run()
+	} else {
+		run()
+	}
+	return total
+}
+
+// processFile reads dataFile in format, dispatching a command for every row
+// through r as rows are read
+func processFile(dataFile string, format *Format, execTemplate string, r *runner) error {
+	in, err := openDataFile(dataFile, defaultEncoding)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return processInput(in, format, execTemplate, r)
+}
+
+// processInput reads in in format, dispatching a command for every row
+// through r as rows are read. Rows can only be counted for regular data
+// files; for other inputs, including pipes given with -d, Progress.Total
+// stays unknown.
+func processInput(in *dataInput, format *Format, execTemplate string, r *runner) error {
+	tmpl, err := newCommandTemplate(execTemplate, r.templates)
+	if err != nil {
+		return err
+	}
+
+	source, err := format.Open(in.reader)
+	if err != nil {
+		return err
+	}
+
+	r.runInfo.file = in.path
+	total := &rowTotal{}
+	if in.regular() {
+		total = countRows(in.path, in.encoding, format.Count, r.stream)
+	}
+
+	// An aborted run stops reading from the data command, which may never
+	// finish on its own
+	defer context.AfterFunc(r.ctx, in.stop)()
+	if err := processRows(source, total, tmpl, r); err != nil {
+		if in.cmd != nil && r.aborted() {
+			// Reading ended because the data command was stopped
+			return nil
+		}
+		return err
+	}
+	if err := in.wait(); err != nil && !r.aborted() {
+		return err
+	}
+	return nil
+}
+
+// processRows renders tmpl for every row of source and dispatches the
+// commands through r, waiting for them to finish before returning. The fields
+// the template refers to, and with --var-conflict=error the names of the
+// variables, are checked against the first row read, before any command runs.
+func processRows(source RowSource, total *rowTotal, tmpl *template.Template, r *runner) error {
+	defer r.wait()
+	fields := templateFields(tmpl)
+	checked := false
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		progress := Progress{Current: row.Index, Total: total.get()}
+		if row.Err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read row %d: %v\n", row.Index, row.Err)
+			r.skip(rowJob{progress: progress}, RowTemplateError)
+			continue
+		}
+
+		data, err := r.templates.withVars(templateData(row.Values))
+		if err != nil {
+			if !checked {
+				return fmt.Errorf("row %d: %v", row.Index, err)
+			}
+			fmt.Fprintf(os.Stderr, "Template execution error for row %d: %v\n", row.Index, err)
+			r.skip(rowJob{progress: progress, data: stringValues(row.Values), row: row}, RowTemplateError)
+			continue
+		}
+		meta := rowMeta{run: r.runInfo, progress: progress}
+		if !checked {
+			checked = true
+			if missing := missingFields(fields, templateVars(data, meta, 1)); len(missing) > 0 {
+				message := fmt.Sprintf("template refers to fields missing from the data: %s (row %d has %s)",
+					strings.Join(missing, ", "), row.Index, strings.Join(rowFieldNames(row), ", "))
+				if r.templates.strict {
+					return fmt.Errorf("%s", message)
+				}
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+			}
+		}
+
+		job := rowJob{
+			progress: progress,
+			data:     stringValues(row.Values),
+			row:      row,
+			render:   templateRenderer(tmpl, data, meta),
+		}
+		if job.command, err = job.render(1); err != nil {
+			fmt.Fprintf(os.Stderr, "Template execution error for row %d: %v\n", row.Index, err)
+			r.skip(job, RowTemplateError)
+			continue
+		}
+
+		r.dispatch(job)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountRows(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       func(io.Reader) (int, error)
+		content     string
+		expected    int
+		expectError bool
+	}{
+		{name: "csv", count: formats["csv"].Count, content: "a,b\n1,2\n\"x\ny\",3\n", expected: 2},
+		{name: "csv header only", count: formats["csv"].Count, content: "a,b\n", expected: 0},
+		{name: "json", count: formats["json"].Count, content: `[{"a": [1, 2]}, {"a": {"b": "]"}}, {}]`, expected: 3},
+		{name: "json not an array", count: formats["json"].Count, content: `{"a": 1}`, expectError: true},
+		{name: "jsonl", count: formats["jsonl"].Count, content: "{\"a\": 1}\n\n  \n{\"a\": 2}", expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := tt.count(strings.NewReader(tt.content))
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if n != tt.expected {
+				t.Errorf("Expected %d rows, got %d", tt.expected, n)
+			}
+		})
+	}
+}
+
+func TestProgressString(t *testing.T) {
+	if s := (Progress{Current: 3, Total: 10}).String(); s != "[3/10]" {
+		t.Errorf("Expected [3/10], got %s", s)
+	}
+	if s := (Progress{Current: 3}).String(); s != "[3/?]" {
+		t.Errorf("Expected [3/?], got %s", s)
+	}
+}
+
+func TestProcessDataFileStreaming(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		template string
+	}{
+		{name: "csv", file: "data.csv", content: "id\n1\n2\n3\n", template: "echo {{.id}}"},
+		{name: "json", file: "data.json", content: `[{"id": 1}, {"id": 2}, {"id": 3}]`, template: "echo {{.id}}"},
+		{name: "jsonl", file: "data.jsonl", content: "{\"id\": 1}\n{\"id\": 2}\n\n{\"id\": 3}\n", template: "echo {{.id}}"},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			name := tt.name
+			if stream {
+				name += " streamed"
+			}
+			t.Run(name, func(t *testing.T) {
+				dataFile := filepath.Join(t.TempDir(), tt.file)
+				if err := os.WriteFile(dataFile, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("Failed to write data file: %v", err)
+				}
+
+				var commands []string
+				var progresses []Progress
+				r := newRunner(func(command string, progress Progress) error {
+					commands = append(commands, command)
+					progresses = append(progresses, progress)
+					return nil
+				}, 1)
+				r.stream = stream
+				if err := processDataFileWithRunner(dataFile, tt.template, r); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				expected := []string{"echo 1", "echo 2", "echo 3"}
+				if strings.Join(commands, ";") != strings.Join(expected, ";") {
+					t.Errorf("Expected commands %v, got %v", expected, commands)
+				}
+				for i, progress := range progresses {
+					if progress.Current != i+1 {
+						t.Errorf("Expected row %d, got %d", i+1, progress.Current)
+					}
+					// A streamed run may start before the rows have been counted
+					if progress.Total != 3 && (!stream || progress.Total != 0) {
+						t.Errorf("Unexpected total %d for row %d", progress.Total, progress.Current)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestProcessJSONStreamingRunsRowsBeforeError(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(dataFile, []byte(`[{"id": 1}, {"id": 2}, {"id": `), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	var commands []string
+	err := processDataFileWithExecutor(dataFile, "echo {{.id}}", func(command string, progress Progress) error {
+		commands = append(commands, command)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to parse JSON") {
+		t.Fatalf("Expected JSON parse error, got %v", err)
+	}
+	if len(commands) != 2 {
+		t.Errorf("Expected the 2 complete rows to run, got %v", commands)
+	}
+}
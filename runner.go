@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// contextExecutor is a CommandExecutor that stops the command when ctx is cancelled
+type contextExecutor func(ctx context.Context, command string, progress Progress) error
+
+// minFailureRateSample is the number of finished rows needed before
+// FailurePolicy.MaxFailureRate is checked, so that an early failure does not
+// abort the run on its own
+const minFailureRateSample = 10
+
+// FailurePolicy decides when a run is aborted because of failing rows. The
+// zero value never aborts.
+type FailurePolicy struct {
+	// FailFast aborts on the first failing row
+	FailFast bool
+	// MaxFailures aborts once this many rows have failed (0 means no limit)
+	MaxFailures int
+	// MaxFailureRate aborts once this fraction of finished rows have failed (0 means no limit)
+	MaxFailureRate float64
+}
+
+// exceeded reports whether failed out of finished rows crosses the policy,
+// with a description of the threshold that was crossed
+func (p FailurePolicy) exceeded(failed, finished, total int) (string, bool) {
+	if failed == 0 {
+		return "", false
+	}
+	if p.FailFast {
+		return "--fail-fast", true
+	}
+	if p.MaxFailures > 0 && failed >= p.MaxFailures {
+		return fmt.Sprintf("--max-failures %d", p.MaxFailures), true
+	}
+	if p.MaxFailureRate > 0 {
+		sample := minFailureRateSample
+		if total > 0 && total < sample {
+			sample = total
+		}
+		if finished >= sample && float64(failed)/float64(finished) > p.MaxFailureRate {
+			return fmt.Sprintf("--max-failure-rate %g%%", p.MaxFailureRate*100), true
+		}
+	}
+	return "", false
+}
+
+// parseFailureRate parses a percentage such as "5%" or "5" into a fraction
+func parseFailureRate(s string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || value < 0 || value > 100 {
+		return 0, fmt.Errorf("invalid failure rate %q (expected a percentage between 0 and 100)", s)
+	}
+	return value / 100, nil
+}
+
+// runner dispatches rendered commands to an executor, running up to jobs
+// commands concurrently, retrying them according to its RetryPolicy and
+// aborting the run when its FailurePolicy is crossed or abort is called
+type runner struct {
+	executor contextExecutor
+	jobs     int
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	summary  *RunSummary
+	policy   FailurePolicy
+	retry    RetryPolicy
+
+	// stream dispatches rows before the data file has been counted, leaving
+	// Progress.Total 0 until the count is known
+	stream bool
+	// timeout bounds every attempt of a command (0 means no limit)
+	timeout time.Duration
+	// state, when set, records row outcomes and skips rows that already
+	// succeeded in a previous run
+	state *StateFile
+	// failedRows, when set, receives every row that did not succeed
+	failedRows *failedRowsWriter
+	// results and annotate, when set, receive a report for every row, with
+	// the output collected by captures
+	results  *resultsWriter
+	annotate *annotateWriter
+	captures *outputCaptures
+	// templates configures how the command template is parsed and rendered
+	templates templateOptions
+	// runInfo describes the run to templates
+	runInfo runInfo
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	abortOnce sync.Once
+	// abortMu guards abortReason, which callbacks of abortWhenDone may set
+	// at any time
+	abortMu     sync.Mutex
+	abortReason string
+
+	// outputs, when set, is told when each row is done, including rows that
+	// never reach the executor, so that ordered output does not wait for them
+	outputs *outputCoordinator
+}
+
+func newRunner(executor CommandExecutor, jobs int) *runner {
+	return newContextRunner(func(ctx context.Context, command string, progress Progress) error {
+		return executor(command, progress)
+	}, jobs)
+}
+
+func newContextRunner(executor contextExecutor, jobs int) *runner {
+	if jobs < 1 {
+		jobs = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &runner{
+		executor: executor,
+		jobs:     jobs,
+		sem:      make(chan struct{}, jobs),
+		summary:  &RunSummary{},
+		runInfo:  newRunInfo(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// rowJob is a row whose command has been rendered for its first attempt
+type rowJob struct {
+	progress Progress
+	data     map[string]string
+	row      Row
+	command  string
+	render   renderFunc
+}
+
+// dispatch executes the job's command, re-rendering it for every retry. With
+// a single job the command runs inline; otherwise dispatch blocks until a
+// worker slot is free and runs the command in the background. Rows that
+// already succeeded in a resumed run, and rows dispatched after the run was
+// aborted, are recorded as skipped.
+func (r *runner) dispatch(job rowJob) {
+	if r.state != nil && r.state.succeeded(job.progress.Current, rowHash(job.data)) {
+		r.report(rowReport{job: job, status: RowSkipped})
+		r.finish(job.progress, RowSkipped)
+		return
+	}
+
+	if r.jobs == 1 {
+		r.execute(job)
+		return
+	}
+
+	r.sem <- struct{}{}
+	r.wg.Add(1)
+	go func() {
+		defer func() {
+			<-r.sem
+			r.wg.Done()
+		}()
+		r.execute(job)
+	}()
+}
+
+func (r *runner) execute(job rowJob) {
+	progress := job.progress
+	result := &commandResult{command: job.command, started: time.Now()}
+	finish := func(status RowStatus, err error) {
+		result.ended = time.Now()
+		result.err = err
+		r.finishJob(job, status, result)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if r.aborted() {
+			r.skip(job, RowSkipped)
+			return
+		}
+
+		if attempt > 1 {
+			command, err := job.render(attempt)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Template execution error for row %d: %v\n", progress.Current, err)
+				finish(RowTemplateError, err)
+				return
+			}
+			result.command = command
+		}
+
+		progress.Attempt = attempt
+		result.attempts = attempt
+		timedOut, err := r.run(result.command, progress)
+		if err == nil {
+			finish(RowSucceeded, nil)
+			return
+		}
+		if r.aborted() {
+			// The command was cancelled because the whole run was aborted
+			fmt.Fprintf(os.Stderr, "Command cancelled: %v\n", err)
+			finish(RowSkipped, err)
+			return
+		}
+		if !r.retry.shouldRetry(attempt, err) {
+			if timedOut {
+				fmt.Fprintf(os.Stderr, "Command execution error: timed out after %s (%v)\n", r.timeout, err)
+				finish(RowTimedOut, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Command execution error: %v\n", err)
+				finish(RowFailed, err)
+			}
+			return
+		}
+		if timedOut {
+			err = fmt.Errorf("timed out after %s (%v)", r.timeout, err)
+		}
+
+		delay := r.retry.backoff(attempt)
+		fmt.Fprintf(os.Stderr, "Command execution error (attempt %d of %d): %v, retrying in %s\n",
+			attempt, r.retry.Retries+1, err, delay.Round(time.Millisecond))
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+		}
+	}
+}
+
+// run executes a single attempt of command, reporting whether it was stopped
+// because it exceeded the per-command timeout
+func (r *runner) run(command string, progress Progress) (bool, error) {
+	if r.timeout <= 0 {
+		return false, r.executor(r.ctx, command, progress)
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	err := r.executor(ctx, command, progress)
+	timedOut := err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !r.aborted()
+	return timedOut, err
+}
+
+// skip records that the job's row will not be executed, and why
+func (r *runner) skip(job rowJob, status RowStatus) {
+	r.finishJob(job, status, nil)
+}
+
+// finishJob records the final outcome of a job in the state, results and
+// annotate files and, unless it succeeded, in the failed rows file. result is
+// nil when the job's command never ran.
+func (r *runner) finishJob(job rowJob, status RowStatus, result *commandResult) {
+	r.report(rowReport{job: job, status: status, result: result})
+	if r.state != nil && job.data != nil {
+		if err := r.state.record(job.progress.Current, rowHash(job.data), status); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write state file: %v\n", err)
+		}
+	}
+	if r.failedRows != nil && status != RowSucceeded && job.row.Values != nil {
+		if err := r.failedRows.write(job.row); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write failed rows file: %v\n", err)
+		}
+	}
+	r.finish(job.progress, status)
+}
+
+// report passes the outcome of a row to the results and annotate files
+func (r *runner) report(report rowReport) {
+	if r.captures != nil {
+		report.output = r.captures.take(report.job.progress.Current)
+	}
+	if r.results != nil {
+		if err := r.results.write(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write results file: %v\n", err)
+		}
+	}
+	if r.annotate != nil {
+		if err := r.annotate.write(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write annotate file: %v\n", err)
+		}
+	}
+}
+
+// finish records the final outcome of the row at progress
+func (r *runner) finish(progress Progress, status RowStatus) {
+	r.summary.record(progress.Current, status)
+	if r.outputs != nil {
+		r.outputs.done(progress.Current)
+	}
+	if status == RowFailed || status == RowTimedOut || status == RowTemplateError {
+		r.checkFailures(progress)
+	}
+}
+
+// checkFailures aborts the run once the failure policy has been crossed
+func (r *runner) checkFailures(progress Progress) {
+	reason, exceeded := r.policy.exceeded(r.summary.FailureCount(), r.summary.Total(), progress.Total)
+	if exceeded {
+		r.abort(reason + " reached")
+	}
+}
+
+// abortWhenDone aborts the run with reason once ctx is done. The returned
+// function stops watching ctx; call it once the run is over, so that
+// releasing ctx does not abort a finished run.
+func (r *runner) abortWhenDone(ctx context.Context, reason string) func() bool {
+	return context.AfterFunc(ctx, func() {
+		r.abort(reason)
+	})
+}
+
+// abort cancels the run and every command still in flight. Only the first
+// reason is kept.
+func (r *runner) abort(reason string) {
+	r.abortOnce.Do(func() {
+		r.abortMu.Lock()
+		r.abortReason = reason
+		r.abortMu.Unlock()
+		fmt.Fprintf(os.Stderr, "Aborting run: %s, cancelling remaining commands\n", reason)
+		r.cancel()
+	})
+}
+
+// aborted reports whether the run has been aborted
+func (r *runner) aborted() bool {
+	return r.ctx.Err() != nil
+}
+
+// abortCause returns why the run was aborted, or "" if it was not
+func (r *runner) abortCause() string {
+	r.abortMu.Lock()
+	defer r.abortMu.Unlock()
+	return r.abortReason
+}
+
+// wait blocks until all dispatched commands have finished
+func (r *runner) wait() {
+	r.wg.Wait()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// stateRecord is one line of a state file, written when a row finishes
+type stateRecord struct {
+	Row    int    `json:"row"`
+	Hash   string `json:"hash"`
+	Status string `json:"status"`
+	Time   string `json:"time"`
+}
+
+// StateFile records the outcome of every row as it finishes so that an
+// interrupted run can be resumed. It is an append-only JSON Lines file and is
+// safe for concurrent use.
+type StateFile struct {
+	mu   sync.Mutex
+	file *os.File
+	// done maps row numbers to the content hash they had when they last succeeded
+	done map[int]string
+}
+
+// openStateFile opens the state file at path. Without resume the file must
+// not already contain rows, so that a finished run is never replayed by
+// accident; with resume the rows it records as succeeded are loaded.
+func openStateFile(path string, resume bool) (*StateFile, error) {
+	state := &StateFile{done: make(map[int]string)}
+
+	if resume {
+		if err := state.load(path); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Resuming run from %s: %d rows already succeeded\n", path, len(state.done))
+	} else if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		return nil, fmt.Errorf("state file %s already exists; use --resume to continue that run or remove the file", path)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %v", err)
+	}
+	state.file = file
+	return state, nil
+}
+
+func (s *StateFile) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open state file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var record stateRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A run killed mid-write can leave a truncated last line
+			fmt.Fprintf(os.Stderr, "Ignoring unreadable state file line %d: %v\n", line, err)
+			continue
+		}
+		if record.Status == RowSucceeded.String() {
+			s.done[record.Row] = record.Hash
+		} else {
+			delete(s.done, record.Row)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading state file: %v", err)
+	}
+	return nil
+}
+
+// succeeded reports whether row already succeeded with the same content.
+// A row whose content changed since then is reported and run again.
+func (s *StateFile) succeeded(row int, hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.done[row]
+	if !ok {
+		return false
+	}
+	if previous != hash {
+		fmt.Fprintf(os.Stderr, "Row %d changed since the previous run, running it again\n", row)
+		return false
+	}
+	return true
+}
+
+// record appends the outcome of row to the state file
+func (s *StateFile) record(row int, hash string, status RowStatus) error {
+	data, err := json.Marshal(stateRecord{
+		Row:    row,
+		Hash:   hash,
+		Status: status.String(),
+		Time:   time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *StateFile) Close() error {
+	return s.file.Close()
+}
+
+// rowHash returns a content hash identifying a row's data
+func rowHash(data map[string]string) string {
+	// json.Marshal sorts map keys, so equal rows hash equally
+	encoded, _ := json.Marshal(data)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRowHash(t *testing.T) {
+	a := rowHash(map[string]string{"id": "1", "name": "Alice"})
+	b := rowHash(map[string]string{"name": "Alice", "id": "1"})
+	c := rowHash(map[string]string{"id": "1", "name": "Bob"})
+
+	if a != b {
+		t.Error("Expected equal rows to have equal hashes")
+	}
+	if a == c {
+		t.Error("Expected different rows to have different hashes")
+	}
+}
+
+func TestOpenStateFileRefusesExistingRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.state")
+	if err := os.WriteFile(path, []byte(`{"row":1,"hash":"x","status":"succeeded"}`+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	_, err := openStateFile(path, false)
+	if err == nil {
+		t.Fatal("Expected error for existing state file without --resume")
+	}
+	if !strings.Contains(err.Error(), "--resume") {
+		t.Errorf("Expected error to mention --resume, got: %v", err)
+	}
+}
+
+func TestRunnerResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile := filepath.Join(tmpDir, "rows.csv")
+	statePath := filepath.Join(tmpDir, "run.state")
+
+	if err := os.WriteFile(dataFile, []byte("id\n1\n2\n3\n4\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	run := func(resume bool, fail func(progress Progress) bool) []string {
+		state, err := openStateFile(statePath, resume)
+		if err != nil {
+			t.Fatalf("Failed to open state file: %v", err)
+		}
+		defer state.Close()
+
+		var executedCommands []string
+		executor := func(ctx context.Context, command string, progress Progress) error {
+			executedCommands = append(executedCommands, command)
+			if fail(progress) {
+				return errors.New("boom")
+			}
+			return nil
+		}
+
+		r := newContextRunner(executor, 1)
+		r.state = state
+		if err := processDataFileWithRunner(dataFile, "echo {{.id}}", r); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return executedCommands
+	}
+
+	// The first run fails on rows 2 and 4
+	first := run(false, func(progress Progress) bool { return progress.Current%2 == 0 })
+	if len(first) != 4 {
+		t.Fatalf("Expected 4 commands in the first run, got %v", first)
+	}
+
+	// Resuming only runs the rows that did not succeed
+	second := run(true, func(progress Progress) bool { return false })
+	expected := []string{"echo 2", "echo 4"}
+	if strings.Join(second, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected resumed run to execute %v, got %v", expected, second)
+	}
+
+	// Once everything succeeded there is nothing left to run
+	third := run(true, func(progress Progress) bool { return false })
+	if len(third) != 0 {
+		t.Errorf("Expected no commands after every row succeeded, got %v", third)
+	}
+
+	// Rows whose content changed are run again
+	if err := os.WriteFile(dataFile, []byte("id\n1\n20\n3\n4\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	fourth := run(true, func(progress Progress) bool { return false })
+	if strings.Join(fourth, ",") != "echo 20" {
+		t.Errorf("Expected only the changed row to run, got %v", fourth)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// exitRowFailures is the exit status used when one or more rows did not succeed
+const exitRowFailures = 2
+
+// RowStatus is the outcome of processing a single row
+type RowStatus int
+
+const (
+	// RowSucceeded means the row's command ran and exited successfully
+	RowSucceeded RowStatus = iota
+	// RowFailed means the row's command could not be run or exited with an error
+	RowFailed
+	// RowTemplateError means the row could not be turned into a command
+	RowTemplateError
+	// RowSkipped means the row was intentionally not run
+	RowSkipped
+	// RowTimedOut means the row's command was killed after exceeding its timeout
+	RowTimedOut
+)
+
+func (s RowStatus) String() string {
+	switch s {
+	case RowSucceeded:
+		return "succeeded"
+	case RowFailed:
+		return "failed"
+	case RowTemplateError:
+		return "template_error"
+	case RowSkipped:
+		return "skipped"
+	case RowTimedOut:
+		return "timed_out"
+	default:
+		return fmt.Sprintf("RowStatus(%d)", int(s))
+	}
+}
+
+// RunSummary tracks the outcome of every row in a run. It is safe for concurrent use.
+type RunSummary struct {
+	mu             sync.Mutex
+	succeeded      int
+	failed         []int
+	timedOut       []int
+	templateErrors []int
+	skipped        []int
+}
+
+// record stores the outcome of the row numbered row (1-based)
+func (s *RunSummary) record(row int, status RowStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch status {
+	case RowSucceeded:
+		s.succeeded++
+	case RowFailed:
+		s.failed = append(s.failed, row)
+	case RowTemplateError:
+		s.templateErrors = append(s.templateErrors, row)
+	case RowSkipped:
+		s.skipped = append(s.skipped, row)
+	case RowTimedOut:
+		s.timedOut = append(s.timedOut, row)
+	}
+}
+
+// Total returns the number of rows recorded so far
+func (s *RunSummary) Total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.succeeded + len(s.failed) + len(s.timedOut) + len(s.templateErrors) + len(s.skipped)
+}
+
+// FailureCount returns the number of rows that failed, timed out or could not be rendered
+func (s *RunSummary) FailureCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.failed) + len(s.timedOut) + len(s.templateErrors)
+}
+
+// Print writes a human readable summary of the run to w
+func (s *RunSummary) Print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "Summary: %d succeeded, %d failed, %d timed out, %d template errors, %d skipped\n",
+		s.succeeded, len(s.failed), len(s.timedOut), len(s.templateErrors), len(s.skipped))
+	if len(s.failed) > 0 {
+		fmt.Fprintf(w, "Failed rows: %s\n", formatRowNumbers(s.failed))
+	}
+	if len(s.timedOut) > 0 {
+		fmt.Fprintf(w, "Timed out rows: %s\n", formatRowNumbers(s.timedOut))
+	}
+	if len(s.templateErrors) > 0 {
+		fmt.Fprintf(w, "Template error rows: %s\n", formatRowNumbers(s.templateErrors))
+	}
+}
+
+func formatRowNumbers(rows []int) string {
+	sorted := append([]int(nil), rows...)
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, row := range sorted {
+		parts[i] = strconv.Itoa(row)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RowFailureError is returned when one or more rows of a run did not succeed,
+// or when reading the data failed after some rows had run
+type RowFailureError struct {
+	Failed int
+	Total  int
+	// AbortReason describes why the run was stopped early, if it was
+	AbortReason string
+	// Err is the error that ended reading the data, if any
+	Err error
+}
+
+func (e *RowFailureError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	if e.AbortReason != "" {
+		return fmt.Sprintf("run aborted (%s), %d of %d rows failed", e.AbortReason, e.Failed, e.Total)
+	}
+	return fmt.Sprintf("%d of %d rows failed", e.Failed, e.Total)
+}
+
+func (e *RowFailureError) Unwrap() error {
+	return e.Err
+}
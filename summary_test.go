@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRunSummaryPrint(t *testing.T) {
+	summary := &RunSummary{}
+	summary.record(1, RowSucceeded)
+	summary.record(4, RowFailed)
+	summary.record(2, RowFailed)
+	summary.record(3, RowTemplateError)
+	summary.record(5, RowSkipped)
+	summary.record(6, RowTimedOut)
+
+	var buf bytes.Buffer
+	summary.Print(&buf)
+
+	expected := "Summary: 1 succeeded, 2 failed, 1 timed out, 1 template errors, 1 skipped\n" +
+		"Failed rows: 2, 4\n" +
+		"Timed out rows: 6\n" +
+		"Template error rows: 3\n"
+	if buf.String() != expected {
+		t.Errorf("Expected summary %q, got %q", expected, buf.String())
+	}
+	if summary.Total() != 6 {
+		t.Errorf("Expected total 6, got %d", summary.Total())
+	}
+	if summary.FailureCount() != 4 {
+		t.Errorf("Expected 4 failures, got %d", summary.FailureCount())
+	}
+}
+
+func TestProcessDataFileFailureExitStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		ignoreFailures bool
+		expectError    bool
+	}{
+		{
+			name:        "failing rows produce an error",
+			expectError: true,
+		},
+		{
+			name:           "ignore failures restores success",
+			ignoreFailures: true,
+			expectError:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "test_*.csv")
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+
+			csvContent := `code
+0
+1
+0`
+			if _, err := tmpFile.WriteString(csvContent); err != nil {
+				t.Fatalf("Failed to write to temp file: %v", err)
+			}
+			tmpFile.Close()
+
+			config := Config{
+				DataFile:       tmpFile.Name(),
+				Template:       "exit {{.code}}",
+				NoLogFiles:     true,
+				IgnoreFailures: tt.ignoreFailures,
+			}
+			err = processDataFile(config)
+
+			if !tt.expectError {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var rowErr *RowFailureError
+			if !errors.As(err, &rowErr) {
+				t.Fatalf("Expected RowFailureError, got %v", err)
+			}
+			if rowErr.Failed != 1 || rowErr.Total != 3 {
+				t.Errorf("Expected 1 of 3 rows failed, got %d of %d", rowErr.Failed, rowErr.Total)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// runInfo describes a run, for the xrun template variable
+type runInfo struct {
+	// id identifies the run, and is different for every run
+	id string
+	// file is the data file, or empty for data read from stdin or a command
+	file      string
+	startedAt time.Time
+}
+
+func newRunInfo() runInfo {
+	id, _ := newUUID()
+	return runInfo{id: id, startedAt: time.Now()}
+}
+
+// rowMeta describes a row and its run, for the xrun template variable
+type rowMeta struct {
+	run      runInfo
+	progress Progress
+}
+
+// vars returns the fields of the xrun template variable on the given
+// attempt. The total is null until the rows have been counted.
+func (m rowMeta) vars(attempt int) templateObject {
+	var total any = (*templateNull)(nil)
+	if m.progress.Total > 0 {
+		total = m.progress.Total
+	}
+	return templateObject{
+		"index":      m.progress.Current,
+		"total":      total,
+		"run_id":     m.run.id,
+		"file":       m.run.file,
+		"attempt":    attempt,
+		"started_at": m.run.startedAt.Format(time.RFC3339),
+	}
+}
+
+// templateOptions configures how command templates are parsed and rendered
+type templateOptions struct {
+	// strict fails rows whose data lacks a field the template refers to,
+	// instead of substituting <no value>, and aborts the run before any
+	// command is executed if the first row lacks one
+	strict bool
+	// autoEscape is autoEscapeShell to escape every substituted value for
+	// the shell, or autoEscapeNone
+	autoEscape string
+	// vars are the variables given with -v and --vars, available to
+	// templates alongside the row's fields
+	vars map[string]any
+	// varConflict is varConflictRow, varConflictVars or varConflictError,
+	// deciding between a row field and a variable of the same name
+	varConflict string
+}
+
+// newCommandTemplate parses the command template text
+func newCommandTemplate(text string, options templateOptions) (*template.Template, error) {
+	tmpl := template.New("command").Funcs(templateFuncs)
+	if options.strict {
+		tmpl.Option("missingkey=error")
+	}
+	if _, err := tmpl.Parse(text); err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+	if options.autoEscape == autoEscapeShell {
+		if err := escapeShell(tmpl); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// templateObject is an object as seen by templates. Its fields are reached
+// with dots, as in {{.user.address.city}}, and it prints as JSON.
+type templateObject map[string]any
+
+func (o templateObject) String() string {
+	return templateJSON(o)
+}
+
+// templateList is an array as seen by templates. It can be ranged over and
+// prints as JSON.
+type templateList []any
+
+func (l templateList) String() string {
+	return templateJSON(l)
+}
+
+// templateNull is a null as seen by templates. A nil *templateNull prints as
+// nothing and is false in conditions, but is still null inside JSON.
+type templateNull struct{}
+
+func (*templateNull) String() string {
+	return ""
+}
+
+func templateJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// templateData converts a row's values to the data its command is rendered
+// with, keeping their types so that numbers print exactly as read and nested
+// values can be reached
+func templateData(values map[string]any) map[string]any {
+	data := make(map[string]any, len(values))
+	for key, value := range values {
+		data[key] = templateValue(value)
+	}
+	return data
+}
+
+func templateValue(v any) any {
+	switch v := v.(type) {
+	case nil:
+		return (*templateNull)(nil)
+	case map[string]any:
+		object := make(templateObject, len(v))
+		for key, value := range v {
+			object[key] = templateValue(value)
+		}
+		return object
+	case []any:
+		list := make(templateList, len(v))
+		for i, value := range v {
+			list[i] = templateValue(value)
+		}
+		return list
+	}
+	return v
+}
+
+// templateFields returns the row fields tmpl refers to, as paths such as
+// [user address city]. Fields used where dot is no longer the row, as inside
+// {{range}} and {{with}}, are left out, except through $.
+func templateFields(tmpl *template.Template) [][]string {
+	var fields [][]string
+	if tmpl.Tree != nil {
+		collectFields(tmpl.Tree.Root, true, &fields)
+	}
+	return fields
+}
+
+func collectFields(node parse.Node, dotIsRow bool, fields *[][]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, dotIsRow, fields)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, dotIsRow, fields)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, dotIsRow, fields)
+	case *parse.IfNode:
+		collectFields(n.Pipe, dotIsRow, fields)
+		collectFields(n.List, dotIsRow, fields)
+		collectFields(n.ElseList, dotIsRow, fields)
+	case *parse.RangeNode:
+		collectFields(n.Pipe, dotIsRow, fields)
+		collectFields(n.List, false, fields)
+		collectFields(n.ElseList, dotIsRow, fields)
+	case *parse.WithNode:
+		collectFields(n.Pipe, dotIsRow, fields)
+		collectFields(n.List, false, fields)
+		collectFields(n.ElseList, dotIsRow, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectFields(arg, dotIsRow, fields)
+			}
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, dotIsRow, fields)
+	case *parse.FieldNode:
+		if dotIsRow {
+			*fields = append(*fields, n.Ident)
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			*fields = append(*fields, n.Ident[1:])
+		}
+	}
+}
+
+// missingFields returns the fields that data lacks, as dotted paths, sorted.
+// Paths are followed through nested objects only, since other values cannot
+// be told apart from methods of their type here.
+func missingFields(fields [][]string, data map[string]any) []string {
+	seen := make(map[string]bool)
+	var missing []string
+	for _, path := range fields {
+		var object map[string]any = data
+		for i, name := range path {
+			value, ok := object[name]
+			if !ok {
+				if field := strings.Join(path[:i+1], "."); !seen[field] {
+					seen[field] = true
+					missing = append(missing, field)
+				}
+				break
+			}
+			if object, ok = value.(templateObject); !ok {
+				break
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// rowFieldNames lists the fields of a row for messages, in the row's order
+// if it has one
+func rowFieldNames(row Row) []string {
+	if row.Fields != nil {
+		return row.Fields
+	}
+	names := make([]string, 0, len(row.Values))
+	for name := range row.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
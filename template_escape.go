@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Values of --auto-escape
+const (
+	autoEscapeNone  = "none"
+	autoEscapeShell = "shell"
+)
+
+// parseAutoEscape checks an --auto-escape value
+func parseAutoEscape(s string) (string, error) {
+	switch s := strings.ToLower(s); s {
+	case "", autoEscapeNone:
+		return autoEscapeNone, nil
+	case autoEscapeShell:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid --auto-escape %q (expected none or shell)", s)
+}
+
+// shellContext is the quoting in effect at a point of a shell command
+type shellContext int
+
+const (
+	shellUnquoted shellContext = iota
+	shellSingleQuoted
+	shellDoubleQuoted
+)
+
+// shellEscapers name the function escaping a value substituted in each
+// context
+var shellEscapers = map[shellContext]string{
+	shellUnquoted:     "shq",
+	shellSingleQuoted: "escapeSingleQuoted",
+	shellDoubleQuoted: "escapeDoubleQuoted",
+}
+
+// escapeShell makes every action of tmpl that prints a value escape it for
+// the shell quoting around it, as html/template does for HTML: a value is
+// quoted as a word of its own outside quotes, and escaped so that it cannot
+// end the quotes inside '...' or "...". Actions already ending in shq or
+// quote are left alone.
+func escapeShell(tmpl *template.Template) error {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if _, err := escapeShellList(t.Tree, t.Tree.Root, shellUnquoted); err != nil {
+			return fmt.Errorf("failed to escape template: %v", err)
+		}
+	}
+	return nil
+}
+
+// escapeShellList escapes the actions of list, starting in context, and
+// returns the context list ends in
+func escapeShellList(tree *parse.Tree, list *parse.ListNode, context shellContext) (shellContext, error) {
+	if list == nil {
+		return context, nil
+	}
+	for _, node := range list.Nodes {
+		var err error
+		switch n := node.(type) {
+		case *parse.TextNode:
+			context = shellContextAfter(context, string(n.Text))
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) == 0 {
+				escapePipe(n.Pipe, context)
+			}
+		case *parse.IfNode:
+			context, err = escapeShellBranch(tree, "if", &n.BranchNode, context)
+		case *parse.RangeNode:
+			context, err = escapeShellBranch(tree, "range", &n.BranchNode, context)
+		case *parse.WithNode:
+			context, err = escapeShellBranch(tree, "with", &n.BranchNode, context)
+		}
+		if err != nil {
+			return context, err
+		}
+	}
+	return context, nil
+}
+
+// escapeShellBranch escapes both branches of an {{if}}, {{range}} or
+// {{with}}, which must leave the quoting as they found it or end in the same
+// context
+func escapeShellBranch(tree *parse.Tree, name string, branch *parse.BranchNode, context shellContext) (shellContext, error) {
+	location, _ := tree.ErrorContext(branch)
+	after, err := escapeShellList(tree, branch.List, context)
+	if err != nil {
+		return context, err
+	}
+	if name == "range" && after != context {
+		return context, fmt.Errorf("%s: {{range}} must close the shell quotes it opens", location)
+	}
+	elseAfter, err := escapeShellList(tree, branch.ElseList, context)
+	if err != nil {
+		return context, err
+	}
+	if after != elseAfter {
+		return context, fmt.Errorf("%s: the branches of {{%s}} end in different shell quotes", location, name)
+	}
+	return after, nil
+}
+
+// escapePipe appends the escaper for context to pipe
+func escapePipe(pipe *parse.PipeNode, context shellContext) {
+	if n := len(pipe.Cmds); n > 0 {
+		if ident, ok := pipe.Cmds[n-1].Args[0].(*parse.IdentifierNode); ok {
+			switch ident.Ident {
+			case "shq", "quote", shellEscapers[shellSingleQuoted], shellEscapers[shellDoubleQuoted]:
+				return
+			}
+		}
+	}
+	escaper := parse.NewIdentifier(shellEscapers[context]).SetPos(pipe.Position())
+	pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      pipe.Position(),
+		Args:     []parse.Node{escaper},
+	})
+}
+
+// shellContextAfter returns the quoting in effect after text, which starts
+// in context
+func shellContextAfter(context shellContext, text string) shellContext {
+	escaped := false
+	for _, c := range text {
+		switch {
+		case context == shellSingleQuoted:
+			if c == '\'' {
+				context = shellUnquoted
+			}
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case context == shellDoubleQuoted:
+			if c == '"' {
+				context = shellUnquoted
+			}
+		case c == '\'':
+			context = shellSingleQuoted
+		case c == '"':
+			context = shellDoubleQuoted
+		}
+	}
+	return context
+}
+
+// escapeSingleQuoted escapes v for use inside '...'
+func escapeSingleQuoted(v any) string {
+	return strings.ReplaceAll(templateString(v), "'", `'\''`)
+}
+
+// doubleQuoteEscaper escapes the characters special inside "..."
+var doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// escapeDoubleQuoted escapes v for use inside "..."
+func escapeDoubleQuoted(v any) string {
+	return doubleQuoteEscaper.Replace(templateString(v))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestAutoEscapeShell(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		values      map[string]any
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "unquoted",
+			template: "echo {{.v}}",
+			values:   map[string]any{"v": "O'Brien; rm -rf /"},
+			expected: `echo 'O'\''Brien; rm -rf /'`,
+		},
+		{
+			name:     "single quoted",
+			template: "curl -d '{{.v}}'",
+			values:   map[string]any{"v": `{"name": "O'Brien"}`},
+			expected: `curl -d '{"name": "O'\''Brien"}'`,
+		},
+		{
+			name:     "double quoted",
+			template: `echo "hello {{.v}}"`,
+			values:   map[string]any{"v": "$(whoami) `id` \\ \""},
+			expected: `echo "hello \$(whoami) \` + "`id\\`" + ` \\ \""`,
+		},
+		{
+			name:     "escaped quotes do not change the context",
+			template: `echo \'{{.v}} "a\"{{.v}}"`,
+			values:   map[string]any{"v": "a b"},
+			expected: `echo \''a b' "a\"a b"`,
+		},
+		{
+			name:     "explicit quoting is kept",
+			template: "echo {{shq .v}} {{.v | quote}} {{json .v}}",
+			values:   map[string]any{"v": "a b"},
+			expected: `echo 'a b' 'a b' '"a b"'`,
+		},
+		{
+			name:     "branches and ranges",
+			template: `{{if .v}}echo '{{.v}}'{{else}}echo none{{end}}{{range .list}} {{.}}{{end}}{{$x := .v}}`,
+			values:   map[string]any{"v": "it's", "list": []any{"a b", "c"}},
+			expected: `echo 'it'\''s' 'a b' c`,
+		},
+		{
+			name:        "branches ending in different quotes",
+			template:    `{{if .v}}echo '{{else}}echo {{end}}x'`,
+			expectError: true,
+		},
+		{
+			name:        "range leaving quotes open",
+			template:    `{{range .list}}'{{.}}{{end}}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := newCommandTemplate(tt.template, templateOptions{autoEscape: autoEscapeShell})
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			got, err := templateRenderer(tmpl, templateData(tt.values), rowMeta{})(1)
+			if err != nil {
+				t.Fatalf("Failed to render template: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAutoEscapeShellRoundTrip(t *testing.T) {
+	values := []string{
+		"plain",
+		"",
+		"O'Brien",
+		`{"a": "it's $HOME"}`,
+		"$(touch /tmp/xrun-injected) `id` ; | & > < * ? ~ # !",
+		"back\\slash \"quotes\"\nnew line",
+	}
+	tmpl, err := newCommandTemplate(`printf '%s\n' {{.v}} '{{.v}}' "{{.v}}"`, templateOptions{autoEscape: autoEscapeShell})
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	for _, value := range values {
+		command, err := templateRenderer(tmpl, templateData(map[string]any{"v": value}), rowMeta{})(1)
+		if err != nil {
+			t.Fatalf("Failed to render template: %v", err)
+		}
+		output, err := exec.Command("bash", "-c", command).Output()
+		if err != nil {
+			t.Fatalf("Command %s failed: %v", command, err)
+		}
+		expected := strings.Repeat(value+"\n", 3)
+		if string(output) != expected {
+			t.Errorf("Command %s printed %q, expected %q", command, output, expected)
+		}
+	}
+}
+
+func TestParseAutoEscape(t *testing.T) {
+	for input, expected := range map[string]string{"": autoEscapeNone, "none": autoEscapeNone, "Shell": autoEscapeShell} {
+		if got, err := parseAutoEscape(input); err != nil || got != expected {
+			t.Errorf("parseAutoEscape(%q) = %q, %v; expected %q", input, got, err, expected)
+		}
+	}
+	if _, err := parseAutoEscape("html"); err == nil {
+		t.Error("Expected an error for an unknown escaping mode")
+	}
+}
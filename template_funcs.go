@@ -0,0 +1,430 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// templateFuncs are the functions available in command templates, in
+// addition to Go's builtins such as printf and urlquery. Functions taking
+// the value they work on take it last, so that they can be used in
+// pipelines such as {{.name | trim | lower}}.
+var templateFuncs = template.FuncMap{
+	"shq":       shellQuote,
+	"quote":     shellQuote,
+	"json":      jsonString,
+	"sqlstring": sqlString,
+
+	"trim":       func(v any) string { return strings.TrimSpace(templateString(v)) },
+	"trimPrefix": func(prefix string, v any) string { return strings.TrimPrefix(templateString(v), prefix) },
+	"trimSuffix": func(suffix string, v any) string { return strings.TrimSuffix(templateString(v), suffix) },
+	"lower":      func(v any) string { return strings.ToLower(templateString(v)) },
+	"upper":      func(v any) string { return strings.ToUpper(templateString(v)) },
+	"replace":    func(old, new string, v any) string { return strings.ReplaceAll(templateString(v), old, new) },
+	"contains":   func(substr string, v any) bool { return strings.Contains(templateString(v), substr) },
+	"hasPrefix":  func(prefix string, v any) bool { return strings.HasPrefix(templateString(v), prefix) },
+	"hasSuffix":  func(suffix string, v any) bool { return strings.HasSuffix(templateString(v), suffix) },
+	"split":      splitString,
+	"join":       joinList,
+	"padLeft":    func(width int, pad string, v any) string { return padString(width, pad, v, true) },
+	"padRight":   func(width int, pad string, v any) string { return padString(width, pad, v, false) },
+	"default":    defaultValue,
+
+	"b64enc": func(v any) string { return base64.StdEncoding.EncodeToString([]byte(templateString(v))) },
+	"b64dec": base64Decode,
+	"sha256": sha256Hex,
+	"uuid":   newUUID,
+
+	"env": os.Getenv,
+
+	"now":  time.Now,
+	"date": formatDate,
+
+	"add": func(a, b any) (any, error) { return arithmetic("add", a, b) },
+	"sub": func(a, b any) (any, error) { return arithmetic("sub", a, b) },
+	"mul": func(a, b any) (any, error) { return arithmetic("mul", a, b) },
+	"div": func(a, b any) (any, error) { return arithmetic("div", a, b) },
+	"mod": func(a, b any) (any, error) { return arithmetic("mod", a, b) },
+
+	"regexMatch":   regexMatch,
+	"regexFind":    regexFind,
+	"regexReplace": regexReplace,
+
+	// Added by --auto-escape=shell inside quotes
+	"escapeSingleQuoted": escapeSingleQuoted,
+	"escapeDoubleQuoted": escapeDoubleQuoted,
+}
+
+// templateFuncDoc describes a template function for xrun help functions
+type templateFuncDoc struct {
+	usage       string
+	description string
+}
+
+// templateFuncGroups documents templateFuncs, in groups of related functions
+var templateFuncGroups = []struct {
+	name  string
+	funcs []templateFuncDoc
+}{
+	{"Quoting", []templateFuncDoc{
+		{"shq VALUE", "Quote as a single shell word: O'Brien becomes 'O'\\''Brien'"},
+		{"quote VALUE", "Same as shq"},
+		{"json VALUE", "Encode as JSON: a string gets its quotes, an object becomes {\"id\":1}"},
+		{"urlquery VALUE", "Escape for a URL query (Go builtin)"},
+		{"sqlstring VALUE", "Quote as an SQL string literal: 'O''Brien', or NULL for null"},
+	}},
+	{"Strings", []templateFuncDoc{
+		{"trim VALUE", "Remove leading and trailing white space"},
+		{"trimPrefix PREFIX VALUE", "Remove PREFIX from the start, if present"},
+		{"trimSuffix SUFFIX VALUE", "Remove SUFFIX from the end, if present"},
+		{"lower VALUE", "Convert to lower case"},
+		{"upper VALUE", "Convert to upper case"},
+		{"replace OLD NEW VALUE", "Replace every OLD with NEW"},
+		{"contains SUBSTR VALUE", "Report whether VALUE contains SUBSTR"},
+		{"hasPrefix PREFIX VALUE", "Report whether VALUE starts with PREFIX"},
+		{"hasSuffix SUFFIX VALUE", "Report whether VALUE ends with SUFFIX"},
+		{"split SEP VALUE", "Split into a list at every SEP, for range or join"},
+		{"join SEP LIST", "Join the elements of a list with SEP"},
+		{"padLeft WIDTH PAD VALUE", "Pad on the left with PAD to WIDTH characters: padLeft 5 \"0\" 42 is 00042"},
+		{"padRight WIDTH PAD VALUE", "Pad on the right with PAD to WIDTH characters"},
+		{"default DEFAULT VALUE", "DEFAULT if VALUE is missing, null, empty or an empty array or object"},
+	}},
+	{"Encoding and hashing", []templateFuncDoc{
+		{"b64enc VALUE", "Encode as standard base64"},
+		{"b64dec VALUE", "Decode standard base64"},
+		{"sha256 VALUE", "SHA-256 hash as lower-case hex"},
+		{"uuid", "A new random UUID (version 4)"},
+	}},
+	{"Environment", []templateFuncDoc{
+		{"env NAME", "The value of environment variable NAME, or nothing if it is not set"},
+	}},
+	{"Dates", []templateFuncDoc{
+		{"now", "The current time"},
+		{"date LAYOUT TIME", "Format TIME with a Go layout, e.g. date \"2006-01-02\" now; TIME may also be text or Unix seconds"},
+	}},
+	{"Arithmetic", []templateFuncDoc{
+		{"add A B", "A + B"},
+		{"sub A B", "A - B"},
+		{"mul A B", "A * B"},
+		{"div A B", "A / B, rounded toward zero if both are whole numbers"},
+		{"mod A B", "Remainder of A / B"},
+	}},
+	{"Regular expressions", []templateFuncDoc{
+		{"regexMatch PATTERN VALUE", "Report whether VALUE matches PATTERN"},
+		{"regexFind PATTERN VALUE", "The first match of PATTERN, or nothing"},
+		{"regexReplace PATTERN REPLACEMENT VALUE", "Replace every match; REPLACEMENT may refer to groups as $1 or ${name}"},
+	}},
+}
+
+// shellSafe matches words that mean the same to the shell quoted or not
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes v as a single POSIX shell word, e.g. O'Brien becomes
+// 'O'\''Brien'. Words made only of safe characters are left as they are.
+func shellQuote(v any) string {
+	s := templateString(v)
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// jsonString encodes v as JSON, e.g. a string becomes "O'Brien" with its
+// quotes and an object becomes {"id":1}
+func jsonString(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// sqlString quotes v as an SQL string literal, doubling single quotes, and
+// writes null as NULL
+func sqlString(v any) string {
+	if v == nil || v == (*templateNull)(nil) {
+		return "NULL"
+	}
+	return "'" + strings.ReplaceAll(templateString(v), "'", "''") + "'"
+}
+
+// templateString returns v as a template would print it
+func templateString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// listValues returns the elements of v if it is a list
+func listValues(v any) ([]any, bool) {
+	switch v := v.(type) {
+	case templateList:
+		return v, true
+	case []any:
+		return v, true
+	case []string:
+		list := make([]any, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// splitString splits v at every sep
+func splitString(sep string, v any) templateList {
+	parts := strings.Split(templateString(v), sep)
+	list := make(templateList, len(parts))
+	for i, part := range parts {
+		list[i] = part
+	}
+	return list
+}
+
+// joinList joins the elements of a list with sep
+func joinList(sep string, v any) (string, error) {
+	list, ok := listValues(v)
+	if !ok {
+		return "", fmt.Errorf("join: expected a list, got %s", templateString(v))
+	}
+	parts := make([]string, len(list))
+	for i, element := range list {
+		parts[i] = templateString(element)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// padString pads v with repetitions of pad to width characters
+func padString(width int, pad string, v any, left bool) string {
+	s := templateString(v)
+	missing := width - utf8.RuneCountInString(s)
+	if missing <= 0 || pad == "" {
+		return s
+	}
+	padding := []rune(strings.Repeat(pad, missing))[:missing]
+	if left {
+		return string(padding) + s
+	}
+	return s + string(padding)
+}
+
+// defaultValue returns v, or def if v is missing, null or empty
+func defaultValue(def, v any) any {
+	switch v := v.(type) {
+	case nil, *templateNull:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	case templateList:
+		if len(v) == 0 {
+			return def
+		}
+	case templateObject:
+		if len(v) == 0 {
+			return def
+		}
+	}
+	return v
+}
+
+func base64Decode(v any) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(templateString(v))
+	if err != nil {
+		return "", fmt.Errorf("b64dec: %v", err)
+	}
+	return string(data), nil
+}
+
+func sha256Hex(v any) string {
+	sum := sha256.Sum256([]byte(templateString(v)))
+	return hex.EncodeToString(sum[:])
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// dateLayouts are the layouts date accepts times written as text in
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// formatDate formats v, a time, a date or time as text, or Unix seconds,
+// with a Go layout
+func formatDate(layout string, v any) (string, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case string:
+		for _, dateLayout := range dateLayouts {
+			if t, err := time.Parse(dateLayout, v); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "", fmt.Errorf("date: cannot read %q as a time", v)
+		}
+	}
+
+	n, err := toNumber(v)
+	if err != nil {
+		return "", fmt.Errorf("date: cannot read %s as a time", templateString(v))
+	}
+	seconds, fraction := math.Modf(n.float())
+	return time.Unix(int64(seconds), int64(fraction*1e9)).Format(layout), nil
+}
+
+// number is a value used in arithmetic: a whole number if isInt is set, and
+// a floating-point number otherwise
+type number struct {
+	i     int64
+	f     float64
+	isInt bool
+}
+
+func (n number) float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+// toNumber converts numbers and text holding numbers, as CSV values do
+func toNumber(v any) (number, error) {
+	switch v := v.(type) {
+	case int:
+		return number{i: int64(v), isInt: true}, nil
+	case int64:
+		return number{i: v, isInt: true}, nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return number{i: int64(v), isInt: true}, nil
+		}
+		return number{f: float64(v)}, nil
+	case float64:
+		return number{f: v}, nil
+	case json.Number:
+		return toNumber(string(v))
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return number{i: i, isInt: true}, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return number{f: f}, nil
+		}
+	}
+	return number{}, fmt.Errorf("%s is not a number", templateJSON(v))
+}
+
+// arithmetic applies op to a and b, giving a whole number if both are
+func arithmetic(op string, a, b any) (any, error) {
+	x, err := toNumber(a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	if (op == "div" || op == "mod") && y.float() == 0 {
+		return nil, fmt.Errorf("%s: division by zero", op)
+	}
+
+	if x.isInt && y.isInt {
+		switch op {
+		case "add":
+			return x.i + y.i, nil
+		case "sub":
+			return x.i - y.i, nil
+		case "mul":
+			return x.i * y.i, nil
+		case "div":
+			return x.i / y.i, nil
+		default:
+			return x.i % y.i, nil
+		}
+	}
+	switch op {
+	case "add":
+		return x.float() + y.float(), nil
+	case "sub":
+		return x.float() - y.float(), nil
+	case "mul":
+		return x.float() * y.float(), nil
+	case "div":
+		return x.float() / y.float(), nil
+	default:
+		return math.Mod(x.float(), y.float()), nil
+	}
+}
+
+// regexpCache holds compiled patterns, which templates use for every row
+var regexpCache sync.Map
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(pattern, re)
+	return re, nil
+}
+
+func regexMatch(pattern string, v any) (bool, error) {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		return false, fmt.Errorf("regexMatch: %v", err)
+	}
+	return re.MatchString(templateString(v)), nil
+}
+
+func regexFind(pattern string, v any) (string, error) {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		return "", fmt.Errorf("regexFind: %v", err)
+	}
+	return re.FindString(templateString(v)), nil
+}
+
+func regexReplace(pattern, replacement string, v any) (string, error) {
+	re, err := compileRegexp(pattern)
+	if err != nil {
+		return "", fmt.Errorf("regexReplace: %v", err)
+	}
+	return re.ReplaceAllString(templateString(v), replacement), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("XRUN_TEST_TOKEN", "secret")
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]any
+		expected string
+	}{
+		{name: "shq", template: "{{shq .v}}", values: map[string]any{"v": "O'Brien"}, expected: `'O'\''Brien'`},
+		{name: "shq safe word", template: "{{shq .v}}", values: map[string]any{"v": "a/b-c.txt"}, expected: "a/b-c.txt"},
+		{name: "shq empty", template: "{{shq .v}}", values: map[string]any{"v": ""}, expected: "''"},
+		{name: "shq null", template: "{{shq .v}}", values: map[string]any{"v": nil}, expected: "''"},
+		{name: "quote in a pipeline", template: "{{.v | quote}}", values: map[string]any{"v": "a b"}, expected: "'a b'"},
+		{name: "json string", template: "{{json .v}}", values: map[string]any{"v": `say "hi"`}, expected: `"say \"hi\""`},
+		{name: "json object", template: "{{json .v}}", values: map[string]any{"v": map[string]any{"id": 1, "tags": []any{"a"}, "x": nil}}, expected: `{"id":1,"tags":["a"],"x":null}`},
+		{name: "urlquery", template: "{{urlquery .v}}", values: map[string]any{"v": "a b&c"}, expected: "a+b%26c"},
+		{name: "sqlstring", template: "{{sqlstring .v}}", values: map[string]any{"v": "O'Brien"}, expected: "'O''Brien'"},
+		{name: "sqlstring null", template: "{{sqlstring .v}}", values: map[string]any{"v": nil}, expected: "NULL"},
+		{name: "trim and case", template: "{{.v | trim | lower}} {{upper .v | trim}}", values: map[string]any{"v": "  Hello "}, expected: "hello HELLO"},
+		{name: "trimPrefix and trimSuffix", template: `{{.v | trimPrefix "v" | trimSuffix ".tar.gz"}}`, values: map[string]any{"v": "v1.2.tar.gz"}, expected: "1.2"},
+		{name: "replace", template: `{{replace "-" "_" .v}}`, values: map[string]any{"v": "a-b-c"}, expected: "a_b_c"},
+		{name: "contains and prefixes", template: `{{contains "b" .v}} {{hasPrefix "a" .v}} {{hasSuffix "a" .v}}`, values: map[string]any{"v": "abc"}, expected: "true true false"},
+		{name: "split and join", template: `{{range split "," .v}}[{{.}}]{{end}} {{split "," .v | join " "}}`, values: map[string]any{"v": "a,b"}, expected: "[a][b] a b"},
+		{name: "join a data array", template: `{{join ";" .v}}`, values: map[string]any{"v": []any{"x", 1}}, expected: "x;1"},
+		{name: "padLeft", template: `{{.v | padLeft 6 "0"}} {{padLeft 2 "0" .v}}`, values: map[string]any{"v": 42}, expected: "000042 42"},
+		{name: "padRight", template: `[{{padRight 4 " " .v}}] [{{padRight 5 "ab" .v}}]`, values: map[string]any{"v": "é"}, expected: "[é   ] [éabab]"},
+		{name: "default", template: `{{.a | default "x"}} {{.b | default "x"}} {{.c | default "x"}} {{.missing | default "x"}} {{.zero | default "x"}}`, values: map[string]any{"a": "", "b": nil, "c": "set", "zero": 0}, expected: "x x set x 0"},
+		{name: "base64", template: "{{b64enc .v}} {{b64enc .v | b64dec}}", values: map[string]any{"v": "user:pass"}, expected: "dXNlcjpwYXNz user:pass"},
+		{name: "sha256", template: "{{sha256 .v}}", values: map[string]any{"v": "abc"}, expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "env", template: `{{env "XRUN_TEST_TOKEN"}} [{{env "XRUN_TEST_UNSET"}}] {{env "XRUN_TEST_UNSET" | default "none"}}`, expected: "secret [] none"},
+		{name: "date from text", template: `{{date "02/01/2006" .v}}`, values: map[string]any{"v": "2024-01-31"}, expected: "31/01/2024"},
+		{name: "date from RFC 3339", template: `{{date "2006-01-02 15:04" .v}}`, values: map[string]any{"v": "2024-01-31T10:20:30Z"}, expected: "2024-01-31 10:20"},
+		{name: "date from Unix seconds", template: `{{.v | date "2006-01-02"}}`, values: map[string]any{"v": 1706702400}, expected: "2024-01-31"},
+		{name: "integer arithmetic", template: "{{add .a 1}} {{sub .a 1}} {{mul .a 3}} {{div .a 4}} {{mod .a 4}}", values: map[string]any{"a": "10"}, expected: "11 9 30 2 2"},
+		{name: "large integers stay exact", template: "{{add .a 1}}", values: map[string]any{"a": json.Number("9007199254740993")}, expected: "9007199254740994"},
+		{name: "float arithmetic", template: "{{add .a 0.5}} {{div .a 4.0}} {{mul .b 2}}", values: map[string]any{"a": 10, "b": 1.25}, expected: "10.5 2.5 2.5"},
+		{name: "regexMatch", template: `{{if regexMatch "^[0-9]+$" .v}}digits{{else}}other{{end}}`, values: map[string]any{"v": "123"}, expected: "digits"},
+		{name: "regexFind", template: `{{regexFind "[0-9]+" .v}}`, values: map[string]any{"v": "order-42-x"}, expected: "42"},
+		{name: "regexReplace", template: `{{regexReplace "(\\w+)@(\\w+)" "$2/$1" .v}}`, values: map[string]any{"v": "alice@example"}, expected: "example/alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := newCommandTemplate(tt.template, templateOptions{})
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			got, err := templateRenderer(tmpl, templateData(tt.values), rowMeta{})(1)
+			if err != nil {
+				t.Fatalf("Failed to render template: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]any
+	}{
+		{name: "division by zero", template: "{{div .a 0}}", values: map[string]any{"a": 1}},
+		{name: "not a number", template: "{{add .a 1}}", values: map[string]any{"a": "ten"}},
+		{name: "invalid base64", template: "{{b64dec .a}}", values: map[string]any{"a": "!!"}},
+		{name: "invalid date", template: `{{date "2006" .a}}`, values: map[string]any{"a": "yesterday"}},
+		{name: "invalid pattern", template: `{{regexMatch "(" .a}}`, values: map[string]any{"a": "x"}},
+		{name: "join a string", template: `{{join "," .a}}`, values: map[string]any{"a": "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := newCommandTemplate(tt.template, templateOptions{})
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			if got, err := templateRenderer(tmpl, templateData(tt.values), rowMeta{})(1); err == nil {
+				t.Errorf("Expected an error, got %q", got)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncsNowAndUUID(t *testing.T) {
+	tmpl, err := newCommandTemplate(`{{date "2006" now}} {{uuid}} {{uuid}}`, templateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	got, err := templateRenderer(tmpl, nil, rowMeta{})(1)
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	parts := strings.Fields(got)
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if len(parts) != 3 || len(parts[0]) != 4 || !uuid.MatchString(parts[1]) || !uuid.MatchString(parts[2]) || parts[1] == parts[2] {
+		t.Errorf("Expected a year and two different UUIDs, got %q", got)
+	}
+}
+
+func TestTemplateFuncsDocumented(t *testing.T) {
+	documented := make(map[string]bool)
+	for _, group := range templateFuncGroups {
+		for _, f := range group.funcs {
+			name := strings.Fields(f.usage)[0]
+			if _, ok := templateFuncs[name]; !ok && name != "urlquery" {
+				t.Errorf("%s is documented but not defined", name)
+			}
+			documented[name] = true
+		}
+	}
+	for name := range templateFuncs {
+		if !documented[name] && name != shellEscapers[shellSingleQuoted] && name != shellEscapers[shellDoubleQuoted] {
+			t.Errorf("%s is not documented in xrun help functions", name)
+		}
+	}
+}
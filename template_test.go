@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateFields(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: "echo {{.id}} {{.name}}", expected: "[[id] [name]]"},
+		{template: "{{.user.address.city}}", expected: "[[user address city]]"},
+		{template: "{{if .admin}}--admin {{.role}}{{else}}{{.name}}{{end}}", expected: "[[admin] [role] [name]]"},
+		{template: "{{range .tags}}{{.label}} {{$.id}}{{end}}", expected: "[[tags] [id]]"},
+		{template: "{{with .user}}{{.name}}{{else}}{{.fallback}}{{end}}", expected: "[[user] [fallback]]"},
+		{template: `{{printf "%s-%s" .a (.b)}} {{index . "c"}}`, expected: "[[a] [b]]"},
+		{template: "{{$x := .id}}{{$x}}", expected: "[[id]]"},
+		{template: "plain text", expected: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := newCommandTemplate(tt.template, templateOptions{})
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			if got := fmt.Sprint(templateFields(tmpl)); got != tt.expected {
+				t.Errorf("Expected fields %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMissingFields(t *testing.T) {
+	data := templateVars(templateData(map[string]any{
+		"id":   "1",
+		"user": map[string]any{"name": "Alice", "address": map[string]any{"city": "Tokyo"}},
+		"tags": []any{"a"},
+	}), rowMeta{}, 1)
+	fields := [][]string{
+		{"id"}, {"usr_id"}, {"user", "name"}, {"user", "nmae"}, {"user", "address", "zip"},
+		{"tags", "Len"}, {"usr_id"}, {attemptField},
+	}
+
+	got := missingFields(fields, data)
+	expected := []string{"user.address.zip", "user.nmae", "usr_id"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected missing fields %v, got %v", expected, got)
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	tests := []struct {
+		name             string
+		fileName         string
+		content          string
+		template         string
+		strict           bool
+		expectedCommands []string
+		expectedFailed   int
+		expectError      string
+	}{
+		{
+			name:             "lenient mode substitutes <no value>",
+			fileName:         "users.csv",
+			content:          "user_id,name\n1,Alice\n",
+			template:         "curl /users/{{.usr_id}}",
+			expectedCommands: []string{"curl /users/<no value>"},
+		},
+		{
+			name:        "strict mode aborts before running anything",
+			fileName:    "users.csv",
+			content:     "user_id,name\n1,Alice\n2,Bob\n",
+			template:    "curl /users/{{.usr_id}} {{.nmae}} {{.name}}",
+			strict:      true,
+			expectError: "template refers to fields missing from the data: nmae, usr_id (row 1 has user_id, name)",
+		},
+		{
+			name:        "strict mode checks nested fields",
+			fileName:    "users.json",
+			content:     `[{"user": {"id": 1}}]`,
+			template:    "curl /users/{{.user.id}}/{{.user.adress.city}}",
+			strict:      true,
+			expectError: "user.adress",
+		},
+		{
+			name:             "strict mode fails later rows missing a field",
+			fileName:         "users.jsonl",
+			content:          "{\"id\": 1, \"name\": \"Alice\"}\n{\"id\": 2}\n{\"id\": 3, \"name\": \"Carol\"}\n",
+			template:         "greet {{.id}} {{.name}} {{index . \"nickname\"}}",
+			strict:           true,
+			expectedCommands: []string{"greet 1 Alice <no value>", "greet 3 Carol <no value>"},
+			expectedFailed:   1,
+		},
+		{
+			name:             "strict mode accepts the attempt number",
+			fileName:         "users.csv",
+			content:          "id\n1\n",
+			template:         "run {{.id}} {{.xrun_attempt}}",
+			strict:           true,
+			expectedCommands: []string{"run 1 1"},
+		},
+		{
+			name:        "strict mode checks run metadata",
+			fileName:    "users.csv",
+			content:     "id\n1\n",
+			template:    "run {{.id}} {{$.xrun.idx}}",
+			strict:      true,
+			expectError: "fields missing from the data: xrun.idx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataFile := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(dataFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write data file: %v", err)
+			}
+
+			var commands []string
+			r := newRunner(func(command string, progress Progress) error {
+				commands = append(commands, command)
+				return nil
+			}, 1)
+			r.templates = templateOptions{strict: tt.strict}
+
+			err := processDataFileWithRunner(dataFile, tt.template, r)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				if len(commands) > 0 {
+					t.Errorf("Expected no commands to run, got %q", commands)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(commands, "|") != strings.Join(tt.expectedCommands, "|") {
+				t.Errorf("Expected commands %q, got %q", tt.expectedCommands, commands)
+			}
+			if len(r.summary.templateErrors) != tt.expectedFailed {
+				t.Errorf("Expected %d template errors, got %d", tt.expectedFailed, len(r.summary.templateErrors))
+			}
+		})
+	}
+}
+
+func TestTemplateMeta(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(dataFile, []byte("id\n1\n2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	var commands []string
+	r := newRunner(func(command string, progress Progress) error {
+		commands = append(commands, command)
+		return nil
+	}, 1)
+	r.templates = templateOptions{strict: true}
+
+	template := "{{.id}} {{$.xrun.index}}/{{$.xrun.total}} {{$.xrun.attempt}} {{$.xrun.file}} {{$.xrun.run_id}} {{$.xrun.started_at}}"
+	if err := processDataFileWithRunner(dataFile, template, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	startedAt := r.runInfo.startedAt.Format(time.RFC3339)
+	expected := []string{
+		fmt.Sprintf("1 1/2 1 %s %s %s", dataFile, r.runInfo.id, startedAt),
+		fmt.Sprintf("2 2/2 1 %s %s %s", dataFile, r.runInfo.id, startedAt),
+	}
+	if strings.Join(commands, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected commands %q, got %q", expected, commands)
+	}
+	if r.runInfo.id == "" || r.runInfo.id == newRunner(nil, 1).runInfo.id {
+		t.Errorf("Expected a run ID unique to the run, got %q", r.runInfo.id)
+	}
+}
+
+func TestTemplateMetaVars(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]any
+		progress Progress
+		attempt  int
+		expected string
+	}{
+		{name: "attempt", template: "{{$.xrun.attempt}} {{.xrun_attempt}}", attempt: 3, expected: "3 3"},
+		{name: "unknown total is null", template: "{{$.xrun.index}}/{{$.xrun.total}} {{if $.xrun.total}}known{{else}}unknown{{end}}", progress: Progress{Current: 4}, attempt: 1, expected: "4/ unknown"},
+		{name: "json", template: "{{json $.xrun.total}} {{json $.xrun.index}}", progress: Progress{Current: 1}, attempt: 1, expected: "null 1"},
+		{name: "row field wins", template: "{{.xrun}}", values: map[string]any{"xrun": "mine"}, attempt: 1, expected: "mine"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := newCommandTemplate(tt.template, templateOptions{})
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			got, err := templateRenderer(tmpl, templateData(tt.values), rowMeta{progress: tt.progress})(tt.attempt)
+			if err != nil {
+				t.Fatalf("Failed to render template: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
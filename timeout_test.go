@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunnerTimeoutKillsProcessGroup(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile := filepath.Join(tmpDir, "rows.csv")
+	marker := filepath.Join(tmpDir, "leaked")
+
+	csvContent := "delay\n0\n10\n"
+	if err := os.WriteFile(dataFile, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+
+	outputs := newOutputCoordinator(OutputGrouped, nil)
+	executor := func(ctx context.Context, command string, progress Progress) error {
+		out := outputs.begin(progress)
+		defer out.finish()
+		return runCommand(ctx, command, progress, out, true)
+	}
+
+	r := newContextRunner(executor, 2)
+	r.timeout = 500 * time.Millisecond
+	// The background child would create the marker file if it outlived its row
+	template := "(sleep 1 && touch " + marker + ") & sleep {{.delay}}; wait"
+
+	start := time.Now()
+	if err := processDataFileWithRunner(dataFile, template, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected timed out rows to be killed promptly, took %s", elapsed)
+	}
+
+	var buf strings.Builder
+	r.summary.Print(&buf)
+	if !strings.Contains(buf.String(), "0 succeeded, 0 failed, 2 timed out") {
+		t.Errorf("Unexpected summary: %q", buf.String())
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected child processes to be killed with their process group")
+	}
+}
+
+func TestRunnerAbortWhenDone(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString("id\n1\n2\n3\n"); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	var executedCommands []string
+	executor := func(ctx context.Context, command string, progress Progress) error {
+		executedCommands = append(executedCommands, command)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	r := newContextRunner(executor, 1)
+	deadlineCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r.abortWhenDone(deadlineCtx, "--deadline 100ms reached")
+
+	if err := processDataFileWithRunner(tmpFile.Name(), "echo {{.id}}", r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(executedCommands) != 1 {
+		t.Errorf("Expected only the first command to start, got %v", executedCommands)
+	}
+	if r.abortCause() != "--deadline 100ms reached" {
+		t.Errorf("Expected deadline abort reason, got %q", r.abortCause())
+	}
+	var buf strings.Builder
+	r.summary.Print(&buf)
+	if !strings.Contains(buf.String(), "0 succeeded, 0 failed, 0 timed out, 0 template errors, 3 skipped") {
+		t.Errorf("Unexpected summary: %q", buf.String())
+	}
+}
+
+func TestProcessGroupRelease(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "leaked")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// The straggler ignores SIGTERM and holds no output, so Wait returns as
+	// soon as the shell exits, long before the grace period ends
+	cmd := exec.CommandContext(ctx, "bash", "-c", "(trap '' TERM; sleep 1; touch "+marker+") >/dev/null 2>&1 & sleep 10")
+	release := setProcessGroup(cmd, time.Minute)
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("Expected the cancelled command to fail")
+	}
+	release()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the command to exit on SIGTERM, took %s", elapsed)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected release to kill the rest of the process group")
+	}
+}
+
+func TestConfigKillsCommands(t *testing.T) {
+	tests := []struct {
+		config   Config
+		expected bool
+	}{
+		{config: Config{}, expected: false},
+		{config: Config{Jobs: 4, RetryPolicy: RetryPolicy{Retries: 2}}, expected: false},
+		{config: Config{Timeout: time.Second}, expected: true},
+		{config: Config{Deadline: time.Minute}, expected: true},
+		{config: Config{FailurePolicy: FailurePolicy{FailFast: true}}, expected: true},
+		{config: Config{FailurePolicy: FailurePolicy{MaxFailureRate: 0.5}}, expected: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.config.killsCommands(); got != tt.expected {
+			t.Errorf("killsCommands() for %+v = %t, expected %t", tt.config, got, tt.expected)
+		}
+	}
+}
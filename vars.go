@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Values of --var-conflict, deciding what a template sees when a row has a
+// field with the name of a variable
+const (
+	varConflictRow   = "row"
+	varConflictVars  = "vars"
+	varConflictError = "error"
+)
+
+// parseVarConflict checks a --var-conflict value
+func parseVarConflict(s string) (string, error) {
+	switch s := strings.ToLower(s); s {
+	case "":
+		return varConflictRow, nil
+	case varConflictRow, varConflictVars, varConflictError:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid --var-conflict %q (expected row, vars or error)", s)
+}
+
+// varFlags collects the key=value pairs given with -v, which may be repeated
+type varFlags map[string]string
+
+func (v varFlags) String() string {
+	pairs := make([]string, 0, len(v))
+	for key, value := range v {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (v varFlags) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid variable %q (expected key=value)", s)
+	}
+	v[key] = value
+	return nil
+}
+
+// loadVars reads the variables in a --vars file, a JSON object whose values
+// may be of any JSON type
+func loadVars(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vars file: %v", err)
+	}
+	var vars map[string]any
+	if err := unmarshalJSON(content, &vars); err != nil {
+		return nil, fmt.Errorf("failed to parse vars file %s: %v (expected a JSON object)", path, err)
+	}
+	return vars, nil
+}
+
+// templateVariables combines the variables of a --vars file with those
+// given with -v, which take precedence, for use in templates
+func templateVariables(file map[string]any, flags varFlags) (map[string]any, error) {
+	vars := make(map[string]any, len(file)+len(flags))
+	for key, value := range file {
+		vars[key] = value
+	}
+	for key, value := range flags {
+		vars[key] = value
+	}
+	for key := range vars {
+		if key == attemptField || key == metaField {
+			return nil, fmt.Errorf("variable %s is reserved by xrun", key)
+		}
+	}
+	return templateData(vars), nil
+}
+
+// withVars returns a row's data with the variables of options added,
+// settling fields that have the name of a variable by options.varConflict
+func (options templateOptions) withVars(data map[string]any) (map[string]any, error) {
+	if len(options.vars) == 0 {
+		return data, nil
+	}
+	merged := make(map[string]any, len(data)+len(options.vars))
+	for key, value := range options.vars {
+		merged[key] = value
+	}
+	var conflicts []string
+	for key, value := range data {
+		if _, ok := options.vars[key]; ok {
+			conflicts = append(conflicts, key)
+			if options.varConflict == varConflictVars {
+				continue
+			}
+		}
+		merged[key] = value
+	}
+	if len(conflicts) > 0 && options.varConflict == varConflictError {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf("row fields have the names of variables: %s", strings.Join(conflicts, ", "))
+	}
+	return merged, nil
+}
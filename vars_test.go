@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVarFlags(t *testing.T) {
+	vars := varFlags{}
+	for _, arg := range []string{"host=api.example.com", "query=a=b", "empty="} {
+		if err := vars.Set(arg); err != nil {
+			t.Fatalf("Set(%q) failed: %v", arg, err)
+		}
+	}
+	if got := vars.String(); got != "empty= host=api.example.com query=a=b" {
+		t.Errorf("Unexpected variables %s", got)
+	}
+	for _, arg := range []string{"host", "=value"} {
+		if err := vars.Set(arg); err == nil {
+			t.Errorf("Expected an error for %q", arg)
+		}
+	}
+}
+
+func TestTemplateVariables(t *testing.T) {
+	varsFile := filepath.Join(t.TempDir(), "vars.json")
+	if err := os.WriteFile(varsFile, []byte(`{"host": "file.example.com", "port": 8080, "tags": ["a", "b"], "big": 9007199254740993}`), 0644); err != nil {
+		t.Fatalf("Failed to write vars file: %v", err)
+	}
+	fileVars, err := loadVars(varsFile)
+	if err != nil {
+		t.Fatalf("Failed to load vars file: %v", err)
+	}
+
+	vars, err := templateVariables(fileVars, varFlags{"host": "flag.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tmpl, err := newCommandTemplate("{{.host}}:{{.port}} {{join \",\" .tags}} {{.big}}", templateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	got, err := templateRenderer(tmpl, vars, rowMeta{})(1)
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	if expected := "flag.example.com:8080 a,b 9007199254740993"; got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	for _, name := range []string{attemptField, metaField} {
+		if _, err := templateVariables(nil, varFlags{name: "1"}); err == nil {
+			t.Errorf("Expected an error for the reserved variable %s", name)
+		}
+	}
+}
+
+func TestLoadVarsErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"array.json": `["a"]`, "invalid.json": `{"a":`, "trailing.json": `{} {}`} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write vars file: %v", err)
+		}
+		if _, err := loadVars(path); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+	if _, err := loadVars(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestParseVarConflict(t *testing.T) {
+	for input, expected := range map[string]string{"": varConflictRow, "row": varConflictRow, "Vars": varConflictVars, "error": varConflictError} {
+		if got, err := parseVarConflict(input); err != nil || got != expected {
+			t.Errorf("parseVarConflict(%q) = %q, %v; expected %q", input, got, err, expected)
+		}
+	}
+	if _, err := parseVarConflict("first"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestVarsInRows(t *testing.T) {
+	tests := []struct {
+		name             string
+		fileName         string
+		content          string
+		conflict         string
+		expectedCommands []string
+		expectedFailed   int
+		expectError      string
+	}{
+		{
+			name:             "row fields take precedence",
+			fileName:         "users.csv",
+			content:          "id,host\n1,\n2,other.example.com\n",
+			expectedCommands: []string{"curl https:///users/1 -H 'Authorization: secret'", "curl https://other.example.com/users/2 -H 'Authorization: secret'"},
+		},
+		{
+			name:             "variables take precedence",
+			fileName:         "users.csv",
+			content:          "id,host\n1,\n2,other.example.com\n",
+			conflict:         varConflictVars,
+			expectedCommands: []string{"curl https://api.example.com/users/1 -H 'Authorization: secret'", "curl https://api.example.com/users/2 -H 'Authorization: secret'"},
+		},
+		{
+			name:             "no conflict",
+			fileName:         "users.csv",
+			content:          "id\n1\n",
+			conflict:         varConflictError,
+			expectedCommands: []string{"curl https://api.example.com/users/1 -H 'Authorization: secret'"},
+		},
+		{
+			name:        "conflicts abort the run on the first row",
+			fileName:    "users.csv",
+			content:     "id,host,token\n1,a,b\n",
+			conflict:    varConflictError,
+			expectError: "row 1: row fields have the names of variables: host, token",
+		},
+		{
+			name:             "conflicts fail later rows",
+			fileName:         "users.jsonl",
+			content:          "{\"id\": 1}\n{\"id\": 2, \"host\": \"a\"}\n{\"id\": 3}\n",
+			conflict:         varConflictError,
+			expectedCommands: []string{"curl https://api.example.com/users/1 -H 'Authorization: secret'", "curl https://api.example.com/users/3 -H 'Authorization: secret'"},
+			expectedFailed:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataFile := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(dataFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write data file: %v", err)
+			}
+
+			var commands []string
+			r := newRunner(func(command string, progress Progress) error {
+				commands = append(commands, command)
+				return nil
+			}, 1)
+			vars, err := templateVariables(nil, varFlags{"host": "api.example.com", "token": "secret"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			r.templates = templateOptions{strict: true, vars: vars, varConflict: tt.conflict}
+
+			err = processDataFileWithRunner(dataFile, "curl https://{{.host}}/users/{{.id}} -H 'Authorization: {{.token}}'", r)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				if len(commands) > 0 {
+					t.Errorf("Expected no commands to run, got %q", commands)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(commands, "|") != strings.Join(tt.expectedCommands, "|") {
+				t.Errorf("Expected commands %q, got %q", tt.expectedCommands, commands)
+			}
+			if len(r.summary.templateErrors) != tt.expectedFailed {
+				t.Errorf("Expected %d template errors, got %d", tt.expectedFailed, len(r.summary.templateErrors))
+			}
+		})
+	}
+}